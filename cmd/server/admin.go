@@ -0,0 +1,21 @@
+package main
+
+import (
+	"crypto/subtle"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminAuth rejects requests that don't carry the admin token as a Bearer token
+func adminAuth(token string) gin.HandlerFunc {
+	expected := []byte("Bearer " + token)
+
+	return func(c *gin.Context) {
+		header := []byte(c.GetHeader("Authorization"))
+		if subtle.ConstantTimeCompare(header, expected) != 1 {
+			c.AbortWithStatusJSON(401, gin.H{"error": "invalid admin token"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -3,22 +3,37 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/bananalabs-oss/bananasplit/internal/catalog"
 	"github.com/bananalabs-oss/bananasplit/internal/matcher"
+	"github.com/bananalabs-oss/bananasplit/internal/matches"
+	"github.com/bananalabs-oss/bananasplit/internal/penalties"
 	"github.com/bananalabs-oss/bananasplit/internal/players"
 	"github.com/bananalabs-oss/bananasplit/internal/queue"
 	"github.com/bananalabs-oss/bananasplit/internal/referrals"
+	"github.com/bananalabs-oss/bananasplit/internal/registryview"
+	"github.com/bananalabs-oss/bananasplit/internal/state"
 	"github.com/bananalabs-oss/potassium/config"
 	"github.com/bananalabs-oss/potassium/registry"
-	"github.com/bananalabs-oss/potassium/server"
 	"github.com/bananalabs-oss/potassium/relay"
+	"github.com/bananalabs-oss/potassium/server"
 	"github.com/gin-gonic/gin"
 )
 
+// matchRetention is how long finished matches stay in the match store
+const matchRetention = time.Hour
+
+// modesWatchInterval is how often the mode catalogue file is checked for changes
+const modesWatchInterval = 5 * time.Second
+
 type RouteRequest struct {
 	PlayerIP string `json:"player_ip"`
 }
@@ -36,26 +51,160 @@ func main() {
 	relayPort := flag.Int("relay-port", 0, "Relay port for referrals (default 5520)")
 	listenAddr := flag.String("listen", "", "Listen address (default :3000)")
 	tickRate := flag.Int("tick", 0, "Matcher tick rate in ms (default 500)")
+	registryRefresh := flag.Int("registry-refresh", 0, "Registry snapshot refresh interval in ms (default 1000)")
 	queueTimeout := flag.Int("queue-timeout", 0, "Queue timeout in seconds, 0 = disabled (default 300)")
+	matchCooldown := flag.Int("match-cooldown", 0, "Seconds to skip a match after assigning to it failed (default 30)")
+	arrivalTimeout := flag.Int("arrival-timeout", 0, "Seconds matched players have to reach the game server, -1 = never (default 60)")
+	noShowAction := flag.String("no-show", "", "What to do with players who never arrive: requeue or lobby (default requeue)")
+	timeoutAction := flag.String("timeout-action", "", "What to do with players whose queue entry times out: notify, rejoin or switch (default notify)")
+	penaltyLadder := flag.String("penalty-ladder", "", "Escalating queue bans per offense (default 1m,5m,15m,1h)")
+	penaltyDecay := flag.String("penalty-decay", "", "How long an offense counts towards the ladder (default 24h)")
+	adminToken := flag.String("admin-token", "", "Bearer token for /admin endpoints (default disabled)")
+	stateFile := flag.String("state-file", "", "Snapshot file for queues, players and referrals (default disabled)")
+	stateInterval := flag.Int("state-interval", 0, "Snapshot interval in seconds (default 5)")
+	strategies := flag.String("strategy", "", "Matching strategy per mode, e.g. ranked=skill,event=fifo (default fifo)")
+	readyChecks := flag.String("ready-check", "", "Ready check timeout per mode, e.g. ranked=20s (default disabled)")
+	skillModes := flag.String("skill", "", "Rating windows per mode, e.g. ranked=100:5:1000 (base:growth/sec[:max])")
+	teamModes := flag.String("teams", "", "Team layout per mode, e.g. bedwars=4x4,duos=2x2x2x2 (default no teams)")
+	matchSizes := flag.String("sizes", "", "Match sizes per mode, e.g. bedwars=8:12:16:60s (min:ideal:max:relax)")
+	modesFile := flag.String("modes", "", "YAML mode catalogue, replaces the per-mode flags (default any mode may be joined)")
+	joinPolicy := flag.String("join-policy", "", "Queued players joining other modes: reject, move or add (default reject)")
+	priorityMaxWait := flag.Int("priority-max-wait", 0, "Seconds before a queued entry is matched ahead of every priority tier, -1 = never (default 120)")
+	etaWindow := flag.Int("eta-window", 0, "Seconds of recent matches used to estimate queue waits (default 600)")
 	flag.Parse()
 
 	// Resolve: CLI > Env > Default
 	config := struct {
-		PeelURL       string
-		BananagineURL string
-		RelayHost     string
-		RelayPort     int
-		ListenAddr    string
-		TickRate      time.Duration
-		QueueTimeout  time.Duration
+		PeelURL         string
+		BananagineURL   string
+		RelayHost       string
+		RelayPort       int
+		ListenAddr      string
+		TickRate        time.Duration
+		RegistryRefresh time.Duration
+		QueueTimeout    time.Duration
+		MatchCooldown   time.Duration
+		ArrivalTimeout  time.Duration
+		NoShowAction    string
+		TimeoutAction   string
+		PenaltyLadder   string
+		PenaltyDecay    string
+		AdminToken      string
+		StateFile       string
+		StateInterval   time.Duration
+		Strategies      string
+		ReadyChecks     string
+		SkillModes      string
+		TeamModes       string
+		MatchSizes      string
+		ModesFile       string
+		JoinPolicy      string
+		PriorityMaxWait time.Duration
+		ETAWindow       time.Duration
 	}{
-		PeelURL:       config.Resolve(*peelURL, config.EnvOrDefault("PEEL_URL", ""), ""),
-		BananagineURL: config.Resolve(*bananagineURL, config.EnvOrDefault("BANANAGINE_URL", ""), "http://localhost:3000"),
-		RelayHost:     config.Resolve(*relayHost, config.EnvOrDefault("RELAY_HOST", ""), "hycraft.net"),
-		RelayPort:     config.ResolveInt(*relayPort, config.EnvOrDefaultInt("RELAY_PORT", 0), 5520),
-		ListenAddr:    config.Resolve(*listenAddr, config.EnvOrDefault("LISTEN_ADDR", ""), ":3001"),
-		TickRate:      time.Duration(config.ResolveInt(*tickRate, config.EnvOrDefaultInt("TICK_RATE", 0), 500)) * time.Millisecond,
-		QueueTimeout:  time.Duration(config.ResolveInt(*queueTimeout, config.EnvOrDefaultInt("QUEUE_TIMEOUT", 0), 300)) * time.Second,
+		PeelURL:         config.Resolve(*peelURL, config.EnvOrDefault("PEEL_URL", ""), ""),
+		BananagineURL:   config.Resolve(*bananagineURL, config.EnvOrDefault("BANANAGINE_URL", ""), "http://localhost:3000"),
+		RelayHost:       config.Resolve(*relayHost, config.EnvOrDefault("RELAY_HOST", ""), "hycraft.net"),
+		RelayPort:       config.ResolveInt(*relayPort, config.EnvOrDefaultInt("RELAY_PORT", 0), 5520),
+		ListenAddr:      config.Resolve(*listenAddr, config.EnvOrDefault("LISTEN_ADDR", ""), ":3001"),
+		TickRate:        time.Duration(config.ResolveInt(*tickRate, config.EnvOrDefaultInt("TICK_RATE", 0), 500)) * time.Millisecond,
+		RegistryRefresh: time.Duration(config.ResolveInt(*registryRefresh, config.EnvOrDefaultInt("REGISTRY_REFRESH", 0), 1000)) * time.Millisecond,
+		QueueTimeout:    time.Duration(config.ResolveInt(*queueTimeout, config.EnvOrDefaultInt("QUEUE_TIMEOUT", 0), 300)) * time.Second,
+		MatchCooldown:   time.Duration(config.ResolveInt(*matchCooldown, config.EnvOrDefaultInt("MATCH_COOLDOWN", 0), 30)) * time.Second,
+		ArrivalTimeout:  time.Duration(config.ResolveInt(*arrivalTimeout, config.EnvOrDefaultInt("ARRIVAL_TIMEOUT", 0), 60)) * time.Second,
+		NoShowAction:    config.Resolve(*noShowAction, config.EnvOrDefault("NO_SHOW_ACTION", ""), string(matcher.NoShowRequeue)),
+		TimeoutAction:   config.Resolve(*timeoutAction, config.EnvOrDefault("TIMEOUT_ACTION", ""), string(matcher.TimeoutNotify)),
+		PenaltyLadder:   config.Resolve(*penaltyLadder, config.EnvOrDefault("PENALTY_LADDER", ""), "1m,5m,15m,1h"),
+		PenaltyDecay:    config.Resolve(*penaltyDecay, config.EnvOrDefault("PENALTY_DECAY", ""), "24h"),
+		AdminToken:      config.Resolve(*adminToken, config.EnvOrDefault("ADMIN_TOKEN", ""), ""),
+		StateFile:       config.Resolve(*stateFile, config.EnvOrDefault("STATE_FILE", ""), ""),
+		StateInterval:   time.Duration(config.ResolveInt(*stateInterval, config.EnvOrDefaultInt("STATE_INTERVAL", 0), 5)) * time.Second,
+		Strategies:      config.Resolve(*strategies, config.EnvOrDefault("STRATEGIES", ""), ""),
+		ReadyChecks:     config.Resolve(*readyChecks, config.EnvOrDefault("READY_CHECKS", ""), ""),
+		SkillModes:      config.Resolve(*skillModes, config.EnvOrDefault("SKILL_MODES", ""), ""),
+		TeamModes:       config.Resolve(*teamModes, config.EnvOrDefault("TEAM_MODES", ""), ""),
+		MatchSizes:      config.Resolve(*matchSizes, config.EnvOrDefault("MATCH_SIZES", ""), ""),
+		ModesFile:       config.Resolve(*modesFile, config.EnvOrDefault("MODES_FILE", ""), ""),
+		JoinPolicy:      config.Resolve(*joinPolicy, config.EnvOrDefault("JOIN_POLICY", ""), string(queue.JoinReject)),
+		PriorityMaxWait: time.Duration(config.ResolveInt(*priorityMaxWait, config.EnvOrDefaultInt("PRIORITY_MAX_WAIT", 0), 120)) * time.Second,
+		ETAWindow:       time.Duration(config.ResolveInt(*etaWindow, config.EnvOrDefaultInt("ETA_WINDOW", 0), 600)) * time.Second,
+	}
+
+	if config.NoShowAction != string(matcher.NoShowRequeue) && config.NoShowAction != string(matcher.NoShowLobby) {
+		log.Fatalf("Invalid no-show action %q, expected requeue or lobby", config.NoShowAction)
+	}
+	switch matcher.TimeoutAction(config.TimeoutAction) {
+	case matcher.TimeoutNotify, matcher.TimeoutRejoin, matcher.TimeoutSwitch:
+	default:
+		log.Fatalf("Invalid timeout action %q, expected notify, rejoin or switch", config.TimeoutAction)
+	}
+	switch queue.JoinPolicy(config.JoinPolicy) {
+	case queue.JoinReject, queue.JoinMove, queue.JoinAdd:
+	default:
+		log.Fatalf("Invalid join policy %q, expected reject, move or add", config.JoinPolicy)
+	}
+	if config.ETAWindow <= 0 || config.ETAWindow > matchRetention {
+		log.Fatalf("Invalid ETA window %s, expected up to %s", config.ETAWindow, matchRetention)
+	}
+
+	ladder, err := parseDurations(config.PenaltyLadder)
+	if err != nil {
+		log.Fatalf("Invalid penalty ladder: %v", err)
+	}
+	decay, err := time.ParseDuration(config.PenaltyDecay)
+	if err != nil {
+		log.Fatalf("Invalid penalty decay: %v", err)
+	}
+
+	// Per-mode matching rules
+	modes := make(map[string]matcher.ModeConfig)
+	if err := parseSkillModes(config.SkillModes, modes); err != nil {
+		log.Fatalf("Invalid skill modes: %v", err)
+	}
+	if err := parseStrategies(config.Strategies, modes); err != nil {
+		log.Fatalf("Invalid strategies: %v", err)
+	}
+	if err := parseReadyChecks(config.ReadyChecks, modes); err != nil {
+		log.Fatalf("Invalid ready checks: %v", err)
+	}
+	if err := parseTeams(config.TeamModes, modes); err != nil {
+		log.Fatalf("Invalid team layouts: %v", err)
+	}
+	if err := parseSizes(config.MatchSizes, modes); err != nil {
+		log.Fatalf("Invalid match sizes: %v", err)
+	}
+	for mode, cfg := range modes {
+		if _, err := matcher.NewStrategy(cfg); err != nil {
+			log.Fatalf("Mode %s: %v (available: %s)", mode, err, strings.Join(matcher.Strategies(), ", "))
+		}
+	}
+
+	// Mode catalogue: a file listing every mode, or the per-mode flags.
+	// The file may also override these settings, and is reloaded live.
+	settings := catalog.Settings{
+		TickRate:     config.TickRate,
+		QueueTimeout: max(config.QueueTimeout, 0),
+		MaxWait:      max(config.PriorityMaxWait, 0),
+		RelayHost:    config.RelayHost,
+		RelayPort:    config.RelayPort,
+	}
+	modeCatalog := catalog.New(modes, settings)
+	if config.ModesFile != "" {
+		if len(modes) > 0 {
+			log.Fatalf("MODES_FILE replaces STRATEGIES, READY_CHECKS, SKILL_MODES, TEAM_MODES and MATCH_SIZES, set one or the other")
+		}
+		modeCatalog, err = catalog.Load(config.ModesFile, settings)
+		if err != nil {
+			log.Fatalf("Invalid mode catalogue %s: %v", config.ModesFile, err)
+		}
+		modes = modeCatalog.Matching()
+
+		fileSettings := modeCatalog.Settings()
+		config.TickRate = fileSettings.TickRate
+		config.QueueTimeout = fileSettings.QueueTimeout
+		config.PriorityMaxWait = fileSettings.MaxWait
+		config.RelayHost = fileSettings.RelayHost
+		config.RelayPort = fileSettings.RelayPort
 	}
 
 	// Log config
@@ -63,16 +212,79 @@ func main() {
 	fmt.Printf("Bananagine: %s\n", config.BananagineURL)
 	fmt.Printf("Relay: %s:%d\n", config.RelayHost, config.RelayPort)
 	fmt.Printf("Tick rate: %s\n", config.TickRate)
+	fmt.Printf("Registry refresh: %s\n", config.RegistryRefresh)
 	if config.QueueTimeout > 0 {
-		fmt.Printf("Queue timeout: %s\n", config.QueueTimeout)
+		fmt.Printf("Queue timeout: %s (then %s)\n", config.QueueTimeout, config.TimeoutAction)
 	} else {
 		fmt.Println("Queue timeout: disabled")
 	}
+	fmt.Printf("Match cooldown: %s\n", config.MatchCooldown)
+	fmt.Printf("Join policy: %s\n", config.JoinPolicy)
+	if config.PriorityMaxWait > 0 {
+		fmt.Printf("Priority max wait: %s\n", config.PriorityMaxWait)
+	} else {
+		fmt.Println("Priority max wait: disabled")
+	}
+	fmt.Printf("ETA window: %s\n", config.ETAWindow)
+	fmt.Printf("Penalties: %s (decay %s)\n", config.PenaltyLadder, decay)
+	if config.ArrivalTimeout > 0 {
+		fmt.Printf("Arrival timeout: %s (no-shows: %s)\n", config.ArrivalTimeout, config.NoShowAction)
+	} else {
+		fmt.Println("Arrival timeout: disabled")
+	}
 	if config.PeelURL != "" {
 		fmt.Printf("Peel: %s\n", config.PeelURL)
 	} else {
 		fmt.Println("Peel: disabled")
 	}
+	if config.AdminToken != "" {
+		fmt.Println("Admin API: enabled")
+	} else {
+		fmt.Println("Admin API: disabled")
+	}
+	if config.StateFile != "" {
+		fmt.Printf("State: %s (every %s)\n", config.StateFile, config.StateInterval)
+	} else {
+		fmt.Println("State: disabled")
+	}
+	if config.ModesFile != "" {
+		fmt.Printf("Modes: %s (%d modes)\n", config.ModesFile, len(modes))
+	} else {
+		fmt.Println("Modes: any")
+	}
+	for _, mode := range modeCatalog.List() {
+		if !mode.Enabled {
+			fmt.Printf("Mode %s: disabled\n", mode.Name)
+		}
+		if mode.PartyMax > 0 || mode.PartyMin > 1 {
+			fmt.Printf("Party %s: %d-%d\n", mode.Name, mode.PartyMin, mode.PartyMax)
+		}
+		if mode.QueueTimeout != modeCatalog.Settings().QueueTimeout {
+			fmt.Printf("Queue timeout %s: %s\n", mode.Name, mode.QueueTimeout)
+		}
+		if !mode.Priority {
+			fmt.Printf("Priority %s: disabled\n", mode.Name)
+		} else if mode.MaxWait != modeCatalog.Settings().MaxWait {
+			fmt.Printf("Priority max wait %s: %s\n", mode.Name, mode.MaxWait)
+		}
+	}
+	for mode, cfg := range modes {
+		if cfg.Strategy != "" {
+			fmt.Printf("Strategy %s: %s\n", mode, cfg.Strategy)
+		}
+		if cfg.ReadyCheck > 0 {
+			fmt.Printf("Ready check %s: %s\n", mode, cfg.ReadyCheck)
+		}
+		if cfg.Teams != nil {
+			fmt.Printf("Teams %s: %s\n", mode, cfg.Teams)
+		}
+		if cfg.Sizes != nil {
+			fmt.Printf("Sizes %s: %d-%d, ideal %d, relax after %s\n", mode, cfg.Sizes.Min, cfg.Sizes.Max, cfg.Sizes.Ideal, cfg.Sizes.RelaxAfter)
+		}
+		if cfg.Skill != nil {
+			fmt.Printf("Skill %s: window %.0f +%.1f/s (max %.0f)\n", mode, cfg.Skill.BaseWindow, cfg.Skill.Growth, cfg.Skill.MaxWindow)
+		}
+	}
 
 	// Create queue manager
 	queues, err := queue.NewManager(config.QueueTimeout)
@@ -80,9 +292,43 @@ func main() {
 		return
 	}
 
-	// Create player registry and referral queue
+	// Create player registry, referral queue and match store
 	playerRegistry := players.NewRegistry()
 	referralQueue := referrals.NewQueue()
+	matchStore := matches.NewStore(matchRetention)
+
+	// Create penalty tracker and reject banned players at the queue
+	penaltyTracker := penalties.NewTracker(ladder, decay)
+	queues.SetGuard(penaltyTracker.Check)
+	queues.SetPolicy(queue.JoinPolicy(config.JoinPolicy))
+	queues.SetMaxWait(config.PriorityMaxWait)
+
+	// The catalogue and matcher config reload together from the modes file
+	matcherConfig := matcher.Config{
+		RegistryURL:      config.BananagineURL,
+		TickRate:         config.TickRate,
+		MatchCooldown:    config.MatchCooldown,
+		ArrivalTimeout:   config.ArrivalTimeout,
+		NoShowAction:     matcher.NoShowAction(config.NoShowAction),
+		TimeoutAction:    matcher.TimeoutAction(config.TimeoutAction),
+		RelayHost:        config.RelayHost,
+		RelayPort:        config.RelayPort,
+		ThroughputWindow: config.ETAWindow,
+		Modes:            modes,
+	}
+	modeConfig := newReloader(config.ModesFile, settings, modeCatalog, matcherConfig, queues)
+	queues.SetRuleSource(modeConfig.rules)
+	queues.SetModeCheck(modeConfig.check)
+
+	// Restore persisted state (optional)
+	var store *state.Store
+	if config.StateFile != "" {
+		store = state.New(state.NewFileBackend(config.StateFile), queues, playerRegistry, referralQueue, matchStore, penaltyTracker)
+		if err := store.Restore(); err != nil {
+			log.Fatalf("State: %v", err)
+		}
+		store.Start(config.StateInterval)
+	}
 
 	// Create peel client (optional)
 	var peelClient *relay.Client
@@ -90,20 +336,37 @@ func main() {
 		peelClient = relay.NewClient(config.PeelURL)
 	}
 
+	// Create shared registry view
+	serverView := registryview.New(config.BananagineURL, config.RegistryRefresh)
+	serverView.Start()
+
 	// Create matcher
 	m := matcher.New(
-		matcher.Config{
-			RegistryURL: config.BananagineURL,
-			TickRate:    config.TickRate,
-			RelayHost:   config.RelayHost,
-			RelayPort:   config.RelayPort,
-		},
+		matcherConfig,
 		queues,
 		playerRegistry,
 		referralQueue,
 		peelClient,
+		matchStore,
+		serverView,
+		penaltyTracker,
 	)
 
+	// Apply catalogue file changes to the running matcher
+	m.SetConfigSource(modeConfig.matcherConfig())
+
+	// Matches restored mid-assignment have lost their ready check
+	if store != nil {
+		m.CancelUnstarted()
+	}
+
+	// Tell lobbies about timed out players
+	queues.SetExpiredHook(m.QueueExpired)
+
+	if config.ModesFile != "" {
+		go modeConfig.watch(modesWatchInterval)
+	}
+
 	// Start matching loop
 	m.Start()
 	fmt.Println("Matcher started")
@@ -115,6 +378,12 @@ func main() {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
+	// Registry change notification (Bananagine push)
+	r.POST("/registry/changed", func(c *gin.Context) {
+		serverView.Invalidate()
+		c.JSON(200, gin.H{"status": "ok"})
+	})
+
 	r.POST("/route-request", func(c *gin.Context) {
 		var req struct {
 			PlayerIP string `json:"player_ip"`
@@ -125,18 +394,7 @@ func main() {
 		}
 
 		// Find lobby with capacity
-		resp, err := http.Get(config.BananagineURL + "/registry/servers?type=lobby")
-		if err != nil {
-			c.JSON(500, gin.H{"error": "failed to query registry"})
-			return
-		}
-		defer resp.Body.Close()
-
-		var servers []registry.ServerInfo
-		if err := json.NewDecoder(resp.Body).Decode(&servers); err != nil {
-			c.JSON(500, gin.H{"error": "failed to decode registry response"})
-			return
-		}
+		servers := serverView.List(registry.ListFilter{Type: registry.TypeLobby})
 
 		var target *registry.ServerInfo
 
@@ -177,9 +435,12 @@ func main() {
 	// Join queue
 	r.POST("/queue/join", func(c *gin.Context) {
 		var req struct {
-			UUID        string `json:"uuid"`
-			Mode        string `json:"mode"`
-			LobbyServer string `json:"lobbyServer"`
+			UUID        string   `json:"uuid"`
+			Mode        string   `json:"mode"`
+			Modes       []string `json:"modes"` // queue for several modes at once
+			LobbyServer string   `json:"lobbyServer"`
+			Rating      float64  `json:"rating"`
+			Priority    string   `json:"priority"` // vip, requeue, normal or low
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -187,23 +448,88 @@ func main() {
 			return
 		}
 
-		queues.Join(req.Mode, queue.QueueEntry{
+		joined := joinModes(req.Mode, req.Modes)
+		if len(joined) == 0 {
+			c.JSON(400, gin.H{"error": "mode required"})
+			return
+		}
+
+		priority, err := joinPriority(req.Priority, []string{req.UUID}, penaltyTracker)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		ticket, err := queues.JoinModes(joined, queue.QueueEntry{
 			UUID:        req.UUID,
 			LobbyServer: req.LobbyServer,
+			Rating:      req.Rating,
+			Priority:    priority,
 		})
+		if err != nil {
+			rejectJoin(c, err)
+			return
+		}
 
-		c.JSON(200, gin.H{
-			"status":   "queued",
-			"mode":     req.Mode,
-			"position": queues.Size(req.Mode),
+		c.JSON(200, queued(queues, ticket))
+	})
+
+	// Join queue as a party
+	r.POST("/queue/party/join", func(c *gin.Context) {
+		var req struct {
+			Leader      string   `json:"leader"`
+			Members     []string `json:"members"`
+			Mode        string   `json:"mode"`
+			Modes       []string `json:"modes"` // queue for several modes at once
+			LobbyServer string   `json:"lobbyServer"`
+			Rating      float64  `json:"rating"`   // party average
+			Priority    string   `json:"priority"` // vip, requeue, normal or low
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		if req.Leader == "" {
+			c.JSON(400, gin.H{"error": "leader required"})
+			return
+		}
+
+		joined := joinModes(req.Mode, req.Modes)
+		if len(joined) == 0 {
+			c.JSON(400, gin.H{"error": "mode required"})
+			return
+		}
+
+		priority, err := joinPriority(req.Priority, append([]string{req.Leader}, req.Members...), penaltyTracker)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		ticket, err := queues.JoinModes(joined, queue.QueueEntry{
+			UUID:        req.Leader,
+			Members:     req.Members,
+			LobbyServer: req.LobbyServer,
+			Rating:      req.Rating,
+			Priority:    priority,
 		})
+		if err != nil {
+			rejectJoin(c, err)
+			return
+		}
+
+		resp := queued(queues, ticket)
+		resp["size"] = 1 + len(req.Members)
+		c.JSON(200, resp)
 	})
 
 	// Leave queue
 	r.POST("/queue/leave", func(c *gin.Context) {
 		var req struct {
 			UUID string `json:"uuid"`
-			Mode string `json:"mode"`
+			Mode string `json:"mode"` // empty = every queue
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -211,10 +537,60 @@ func main() {
 			return
 		}
 
-		removed := queues.Leave(req.Mode, req.UUID)
+		var removed bool
+		if req.Mode == "" {
+			removed = len(queues.LeaveAll(req.UUID)) > 0
+		} else {
+			removed = queues.Leave(req.Mode, req.UUID)
+		}
+
+		// Leaving after a match was found counts as a dodge
+		if !removed {
+			if _, err := m.Dodge(req.UUID); err == nil {
+				removed = true
+			}
+		}
+
 		c.JSON(200, gin.H{"removed": removed})
 	})
 
+	// Ready check answers
+	r.POST("/queue/accept", func(c *gin.Context) {
+		var req struct {
+			UUID string `json:"uuid"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		matchID, err := m.Accept(req.UUID)
+		if err != nil {
+			c.JSON(404, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"status": "accepted", "matchId": matchID})
+	})
+
+	r.POST("/queue/decline", func(c *gin.Context) {
+		var req struct {
+			UUID string `json:"uuid"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		matchID, err := m.Decline(req.UUID)
+		if err != nil {
+			c.JSON(404, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"status": "declined", "matchId": matchID})
+	})
+
 	// Queue size
 	r.GET("/queue/:mode/size", func(c *gin.Context) {
 		mode := c.Param("mode")
@@ -222,11 +598,66 @@ func main() {
 		c.JSON(200, gin.H{"mode": mode, "size": size})
 	})
 
+	// Mode catalogue
+	r.GET("/modes", func(c *gin.Context) {
+		list := make([]gin.H, 0)
+		modeCatalog := modeConfig.catalog()
+		for _, mode := range modeCatalog.List() {
+			entry := gin.H{
+				"name":         mode.Name,
+				"enabled":      mode.Enabled,
+				"queueTimeout": mode.QueueTimeout.Seconds(),
+				"partyMin":     mode.PartyMin,
+				"partyMax":     mode.PartyMax,
+				"priority":     mode.Priority,
+				"queued":       queues.Size(mode.Name),
+			}
+			if mode.Match.Strategy != "" {
+				entry["strategy"] = mode.Match.Strategy
+			}
+			if mode.Match.Teams != nil {
+				entry["teams"] = mode.Match.Teams.String()
+			}
+			list = append(list, entry)
+		}
+		c.JSON(200, gin.H{"modes": list, "open": modeCatalog.Open()})
+	})
+
+	// Queue status for one player
+	r.GET("/queue/status/:uuid", func(c *gin.Context) {
+		uuid := c.Param("uuid")
+		ticket, found := queues.Lookup(uuid)
+		if !found {
+			c.JSON(404, gin.H{"error": "not queued"})
+			return
+		}
+
+		status := make(map[string]gin.H, len(ticket.Modes))
+		for _, mode := range ticket.Modes {
+			position, _ := queues.Position(mode, ticket.Leader)
+			entry := gin.H{"position": position, "size": queues.Size(mode), "estimatedWait": nil}
+			if eta, ok := m.EstimateWait(mode, position); ok {
+				entry["estimatedWait"] = eta.Seconds()
+			}
+			status[mode] = entry
+		}
+
+		c.JSON(200, gin.H{
+			"uuid":     uuid,
+			"leader":   ticket.Leader,
+			"modes":    ticket.Modes,
+			"queues":   status,
+			"joinedAt": ticket.JoinedAt,
+			"waited":   time.Since(ticket.JoinedAt).Seconds(),
+		})
+	})
+
 	// Match complete (game server reports back)
 	r.POST("/match-complete", func(c *gin.Context) {
 		var req struct {
 			ServerID string `json:"serverId"`
 			MatchID  string `json:"matchId"`
+			Mode     string `json:"mode"` // optional, looked up from the registry if empty
 			Players  []struct {
 				UUID   string `json:"uuid"`
 				Action string `json:"action"` // "requeue" or "lobby"
@@ -241,34 +672,189 @@ func main() {
 		// Find a lobby for players going back
 		lobby, hasLobby := m.FindLobby()
 
+		record, tracked := matchStore.FindActive(req.ServerID, req.MatchID)
+
+		// The match and its backfills know each player's queue entry and
+		// the lobby they queued from
+		var records []matches.Match
+		if tracked {
+			records = append(records, record)
+		}
+		records = append(records, matchStore.Backfills(req.ServerID, req.MatchID)...)
+
+		origins := make(map[string]string)
+		for _, match := range records {
+			for uuid, lobbyID := range match.Lobbies {
+				origins[uuid] = lobbyID
+			}
+		}
+
+		mode := req.Mode
+		if mode == "" && tracked {
+			mode = record.Mode
+		}
+		var requeue []string
+		lobbies := make(map[string]string) // requeued player → lobby they went back to
+
 		for _, player := range req.Players {
 			if player.Action == "requeue" {
-				fmt.Printf("[Bananasplit] Player %s wants requeue (not implemented)\n", player.UUID)
+				if mode == "" {
+					if gameServer, err := m.GetServer(req.ServerID); err == nil {
+						mode = gameServer.Mode
+					}
+				}
+				if mode == "" {
+					fmt.Printf("[Bananasplit] Player %s wants requeue but mode of %s is unknown\n", player.UUID, req.ServerID)
+					continue
+				}
+
+				// Prefer the lobby they queued from, if it still has room
+				originID := origins[player.UUID]
+				lobbyID := originID
+				if target, ok := m.LobbyFor(originID); ok {
+					m.ReturnToLobby(req.ServerID, player.UUID, target)
+					lobbyID = target.ID
+				}
+				if lobbyID == "" {
+					fmt.Printf("[Bananasplit] Player %s wants requeue but no lobby is available\n", player.UUID)
+					continue
+				}
+
+				requeue = append(requeue, player.UUID)
+				lobbies[player.UUID] = lobbyID
 			} else {
 				if hasLobby {
 					fmt.Printf("[Bananasplit] Player %s returning to lobby %s\n", player.UUID, lobby.ID)
+					m.ReturnToLobby(req.ServerID, player.UUID, lobby)
+				}
+			}
+		}
 
-					playerInfo, found := playerRegistry.GetByUUID(player.UUID)
-					if found {
-						backend := fmt.Sprintf("%s:%d", lobby.Host, lobby.Port)
-						if peelClient != nil {
-							if err := peelClient.SetRoute(playerInfo.IP, backend); err != nil {
-								fmt.Printf("[Bananasplit] Failed to set route for %s: %v\n", player.UUID, err)
-							}
-						}
-						referralQueue.Add(req.ServerID, referrals.Referral{
-							PlayerUUID: player.UUID,
-							Host:       config.RelayHost,
-							Port:       config.RelayPort,
-						})
-					}
+		// Requeue the entries players were matched from, so parties stay
+		// together and keep their rating and modes
+		var requeued []queue.QueueEntry
+		grouped := make(map[string]bool)
+		for _, match := range records {
+			for _, entry := range match.Regroup(requeue) {
+				requeued = append(requeued, entry)
+				for _, uuid := range entry.Players() {
+					grouped[uuid] = true
 				}
 			}
 		}
+		for _, uuid := range requeue {
+			if !grouped[uuid] {
+				requeued = append(requeued, queue.QueueEntry{UUID: uuid})
+			}
+		}
+		for i := range requeued {
+			requeued[i].LobbyServer = lobbies[requeued[i].UUID]
+			requeued[i].Priority = m.RequeuePriority(requeued[i])
+			requeued[i].JoinedAt = time.Time{}
+			requeued[i].Rejoined = false
+		}
+
+		// Requeued players skip to the front of the line, unless they are
+		// banned or the mode no longer takes them
+		if len(requeued) > 0 {
+			refused := make(map[string]bool)
+			for _, entry := range queues.Requeue(mode, requeued...) {
+				refused[entry.UUID] = true
+			}
+			for _, entry := range requeued {
+				if refused[entry.UUID] {
+					continue
+				}
+				for _, uuid := range entry.Players() {
+					fmt.Printf("[Bananasplit] Player %s requeued for %s via lobby %s\n", uuid, mode, entry.LobbyServer)
+				}
+			}
+		}
+
+		if tracked {
+			if _, err := matchStore.Transition(record.ID, matches.StateCompleted); err != nil {
+				fmt.Printf("[Bananasplit] Match %s: %v\n", record.ID, err)
+			}
+		}
+		m.CloseBackfill(req.ServerID, req.MatchID)
 
 		c.JSON(200, gin.H{"status": "processed"})
 	})
 
+	// Backfill (game server advertises open slots in a running match)
+	r.POST("/backfill", func(c *gin.Context) {
+		var req struct {
+			ServerID string `json:"serverId"`
+			MatchID  string `json:"matchId"`
+			Slots    int    `json:"slots"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		if req.ServerID == "" || req.MatchID == "" {
+			c.JSON(400, gin.H{"error": "serverId and matchId required"})
+			return
+		}
+
+		mode, err := m.OpenBackfill(req.ServerID, req.MatchID, req.Slots)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Slots <= 0 {
+			c.JSON(200, gin.H{"status": "closed"})
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"status": "open",
+			"mode":   mode,
+			"slots":  req.Slots,
+		})
+	})
+
+	r.DELETE("/backfill/:serverId/:matchId", func(c *gin.Context) {
+		if !m.CloseBackfill(c.Param("serverId"), c.Param("matchId")) {
+			c.JSON(404, gin.H{"error": "backfill not found"})
+			return
+		}
+		c.JSON(200, gin.H{"status": "closed"})
+	})
+
+	// Match arrival (game server confirms players reached it)
+	r.POST("/match-arrival", func(c *gin.Context) {
+		var req struct {
+			ServerID string   `json:"serverId"`
+			MatchID  string   `json:"matchId"`
+			Players  []string `json:"players"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		active, found := matchStore.FindActive(req.ServerID, req.MatchID)
+		if !found {
+			c.JSON(404, gin.H{"error": "match not found"})
+			return
+		}
+
+		for _, uuid := range req.Players {
+			matchStore.Arrive(req.ServerID, uuid)
+		}
+
+		// Report the match asked about, even if the players belonged elsewhere
+		match, _ := matchStore.Get(active.ID)
+		c.JSON(200, gin.H{
+			"state":   match.State,
+			"missing": match.Missing(),
+		})
+	})
+
 	// Endpoint for "Peel Relay"
 	r.GET("/assign", func(c *gin.Context) {
 		ip := c.Query("ip")
@@ -301,6 +887,9 @@ func main() {
 
 		playerRegistry.Register(req.PlayerUUID, req.PlayerIP, req.ServerID)
 		fmt.Printf("[Players] Registered %s on %s\n", req.PlayerUUID, req.ServerID)
+
+		// A matched player landing on their game server counts as arrived
+		matchStore.Arrive(req.ServerID, req.PlayerUUID)
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
@@ -331,6 +920,250 @@ func main() {
 		c.JSON(200, refs)
 	})
 
+	// Matches
+	r.GET("/matches", func(c *gin.Context) {
+		list := matchStore.List(matches.State(c.Query("state")), c.Query("mode"))
+		c.JSON(200, list)
+	})
+
+	r.GET("/matches/:id", func(c *gin.Context) {
+		match, found := matchStore.Get(c.Param("id"))
+		if !found {
+			c.JSON(404, gin.H{"error": "match not found"})
+			return
+		}
+		c.JSON(200, match)
+	})
+
+	// Admin
+	if config.AdminToken != "" {
+		admin := r.Group("/admin", adminAuth(config.AdminToken))
+
+		admin.POST("/reload", func(c *gin.Context) {
+			next, err := modeConfig.reload()
+			if errors.Is(err, errNoModesFile) {
+				c.JSON(409, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(422, gin.H{"error": err.Error(), "status": "kept running config"})
+				return
+			}
+
+			settings := next.Settings()
+			c.JSON(200, gin.H{
+				"status":    "reloaded",
+				"modes":     len(next.List()),
+				"tickRate":  settings.TickRate.Milliseconds(),
+				"relayHost": settings.RelayHost,
+				"relayPort": settings.RelayPort,
+			})
+		})
+
+		// Queue inspection, for unsticking players
+		admin.GET("/queues/:mode", func(c *gin.Context) {
+			mode := c.Param("mode")
+			var entries []queue.QueueEntry
+			if limit := c.Query("limit"); limit != "" {
+				n, err := strconv.Atoi(limit)
+				if err != nil || n < 0 {
+					c.JSON(400, gin.H{"error": "invalid limit"})
+					return
+				}
+				entries = queues.Peek(mode, n)
+			} else {
+				entries = queues.Entries(mode)
+			}
+
+			type listed struct {
+				queue.QueueEntry
+				Position int     `json:"position"`
+				Waited   float64 `json:"waited"`
+			}
+
+			now := time.Now()
+			position := 0
+			list := make([]listed, 0, len(entries))
+			for _, entry := range entries {
+				position += entry.Size()
+				list = append(list, listed{entry, position, now.Sub(entry.JoinedAt).Seconds()})
+			}
+
+			c.JSON(200, gin.H{
+				"mode":    mode,
+				"size":    queues.Size(mode),
+				"paused":  queues.IsPaused(mode),
+				"entries": list,
+			})
+		})
+
+		admin.DELETE("/queues/:mode", func(c *gin.Context) {
+			mode := c.Param("mode")
+			cleared := queues.Clear(mode)
+
+			players := 0
+			for _, entry := range cleared {
+				players += entry.Size()
+			}
+			fmt.Printf("[Admin] Cleared %s: %d entries, %d players\n", mode, len(cleared), players)
+			c.JSON(200, gin.H{"mode": mode, "cleared": players})
+		})
+
+		admin.DELETE("/queues/:mode/players/:uuid", func(c *gin.Context) {
+			mode, uuid := c.Param("mode"), c.Param("uuid")
+			removed := queues.Leave(mode, uuid)
+			if removed {
+				fmt.Printf("[Admin] Removed %s from %s\n", uuid, mode)
+			}
+			c.JSON(200, gin.H{"removed": removed})
+		})
+
+		admin.POST("/queues/:mode/players/:uuid/front", func(c *gin.Context) {
+			mode, uuid := c.Param("mode"), c.Param("uuid")
+			if !queues.MoveToFront(mode, uuid) {
+				c.JSON(404, gin.H{"error": "not queued for " + mode})
+				return
+			}
+			fmt.Printf("[Admin] Moved %s to the front of %s\n", uuid, mode)
+
+			position, _ := queues.Position(mode, uuid)
+			c.JSON(200, gin.H{"mode": mode, "position": position})
+		})
+
+		admin.POST("/queues/:mode/pause", func(c *gin.Context) {
+			mode := c.Param("mode")
+			if queues.Pause(mode) {
+				fmt.Printf("[Admin] Paused matching for %s\n", mode)
+			}
+			c.JSON(200, gin.H{"mode": mode, "paused": true})
+		})
+
+		admin.POST("/queues/:mode/resume", func(c *gin.Context) {
+			mode := c.Param("mode")
+			if queues.Resume(mode) {
+				fmt.Printf("[Admin] Resumed matching for %s\n", mode)
+			}
+			c.JSON(200, gin.H{"mode": mode, "paused": false})
+		})
+
+		// Pulls players off live game servers, so operators only
+		admin.POST("/matches/:id/cancel", func(c *gin.Context) {
+			match, err := m.CancelMatch(c.Param("id"))
+			if errors.Is(err, matches.ErrNotFound) {
+				c.JSON(404, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(409, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(200, match)
+		})
+
+		admin.GET("/penalties", func(c *gin.Context) {
+			c.JSON(200, penaltyTracker.List())
+		})
+
+		admin.GET("/penalties/:uuid", func(c *gin.Context) {
+			penalty, found := penaltyTracker.Get(c.Param("uuid"))
+			if !found {
+				c.JSON(404, gin.H{"error": "no penalties"})
+				return
+			}
+			c.JSON(200, gin.H{
+				"penalty":   penalty,
+				"remaining": penaltyTracker.Remaining(penalty.UUID).Seconds(),
+			})
+		})
+
+		admin.DELETE("/penalties/:uuid", func(c *gin.Context) {
+			cleared := penaltyTracker.Clear(c.Param("uuid"))
+			c.JSON(200, gin.H{"cleared": cleared})
+		})
+	}
+
 	server.ListenAndShutdown(config.ListenAddr, r, "Bananasplit")
+
+	// Final snapshot so nothing since the last interval is lost
+	if store != nil {
+		if err := store.Save(); err != nil {
+			fmt.Printf("[State] %v\n", err)
+		}
+	}
 }
 
+// joinModes combines the mode and modes of a join request, dropping empty
+// and repeated modes
+func joinModes(mode string, list []string) []string {
+	var joined []string
+	seen := make(map[string]bool)
+	for _, m := range append([]string{mode}, list...) {
+		if m != "" && !seen[m] {
+			seen[m] = true
+			joined = append(joined, m)
+		}
+	}
+	return joined
+}
+
+// joinPriority checks a join's requested priority tier. Players with recent
+// offenses always queue at low priority.
+func joinPriority(requested string, uuids []string, tracker *penalties.Tracker) (queue.Priority, error) {
+	priority := queue.Priority(requested)
+	if !priority.Valid() {
+		return "", fmt.Errorf("invalid priority %q, expected vip, requeue, normal or low", requested)
+	}
+	if tracker.Penalized(uuids) {
+		return queue.PriorityLow, nil
+	}
+	return priority, nil
+}
+
+// queued builds the response to a successful join. Joins for several modes
+// also list the position in each. A repeated join reports the existing
+// entry.
+func queued(queues *queue.Manager, ticket queue.Ticket) gin.H {
+	position, _ := queues.Position(ticket.Modes[0], ticket.Leader)
+	resp := gin.H{
+		"status":   "queued",
+		"mode":     ticket.Modes[0],
+		"position": position,
+		"joinedAt": ticket.JoinedAt,
+	}
+	if len(ticket.Modes) > 1 {
+		positions := make(map[string]int, len(ticket.Modes))
+		for _, mode := range ticket.Modes {
+			positions[mode], _ = queues.Position(mode, ticket.Leader)
+		}
+		resp["modes"] = ticket.Modes
+		resp["positions"] = positions
+	}
+	if ticket.Repeat {
+		resp["status"] = "already-queued"
+	}
+	return resp
+}
+
+// rejectJoin responds to a queue join that was refused
+func rejectJoin(c *gin.Context, err error) {
+	var queuedErr *queue.AlreadyQueuedError
+	if errors.As(err, &queuedErr) {
+		c.JSON(409, gin.H{
+			"error": err.Error(),
+			"uuid":  queuedErr.UUID,
+			"modes": queuedErr.Modes,
+		})
+		return
+	}
+
+	var banned *penalties.BannedError
+	if errors.As(err, &banned) {
+		c.JSON(403, gin.H{
+			"error":     err.Error(),
+			"uuid":      banned.UUID,
+			"remaining": banned.Remaining.Seconds(),
+		})
+		return
+	}
+	c.JSON(400, gin.H{"error": err.Error()})
+}
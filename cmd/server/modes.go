@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bananalabs-oss/bananasplit/internal/matcher"
+)
+
+// parseModeList splits "mode=value,mode=value" into a map of mode → value
+func parseModeList(s string) (map[string]string, error) {
+	result := make(map[string]string)
+	if s == "" {
+		return result, nil
+	}
+
+	for _, item := range strings.Split(s, ",") {
+		mode, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok || mode == "" || value == "" {
+			return nil, fmt.Errorf("invalid mode setting %q, expected mode=value", item)
+		}
+		result[mode] = value
+	}
+	return result, nil
+}
+
+// parseSkillModes parses "mode=base:growth[:max],..." into per-mode skill settings
+func parseSkillModes(s string, modes map[string]matcher.ModeConfig) error {
+	list, err := parseModeList(s)
+	if err != nil {
+		return err
+	}
+
+	for mode, value := range list {
+		parts := strings.Split(value, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return fmt.Errorf("invalid skill setting for %s, expected base:growth[:max]", mode)
+		}
+
+		nums := make([]float64, 3)
+		for i, part := range parts {
+			n, err := strconv.ParseFloat(part, 64)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid skill setting for %s: %q", mode, part)
+			}
+			nums[i] = n
+		}
+
+		cfg := modes[mode]
+		cfg.Skill = &matcher.SkillConfig{
+			BaseWindow: nums[0],
+			Growth:     nums[1],
+			MaxWindow:  nums[2],
+		}
+		modes[mode] = cfg
+	}
+	return nil
+}
+
+// parseStrategies parses "mode=strategy,..." into per-mode strategy names
+func parseStrategies(s string, modes map[string]matcher.ModeConfig) error {
+	list, err := parseModeList(s)
+	if err != nil {
+		return err
+	}
+
+	for mode, name := range list {
+		cfg := modes[mode]
+		cfg.Strategy = name
+		modes[mode] = cfg
+	}
+	return nil
+}
+
+// parseReadyChecks parses "mode=duration,..." into per-mode ready check timeouts
+func parseReadyChecks(s string, modes map[string]matcher.ModeConfig) error {
+	list, err := parseModeList(s)
+	if err != nil {
+		return err
+	}
+
+	for mode, value := range list {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid ready check for %s: %q", mode, value)
+		}
+
+		cfg := modes[mode]
+		cfg.ReadyCheck = timeout
+		modes[mode] = cfg
+	}
+	return nil
+}
+
+// parseTeams parses "mode=4x4,..." into per-mode team layouts
+func parseTeams(s string, modes map[string]matcher.ModeConfig) error {
+	list, err := parseModeList(s)
+	if err != nil {
+		return err
+	}
+
+	for mode, value := range list {
+		layout, err := matcher.ParseTeamLayout(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", mode, err)
+		}
+
+		cfg := modes[mode]
+		cfg.Teams = layout
+		modes[mode] = cfg
+	}
+	return nil
+}
+
+// parseSizes parses "mode=min:ideal:max:relax,..." into per-mode match sizes.
+// Call it after parseTeams.
+func parseSizes(s string, modes map[string]matcher.ModeConfig) error {
+	list, err := parseModeList(s)
+	if err != nil {
+		return err
+	}
+
+	for mode, value := range list {
+		parts := strings.Split(value, ":")
+		if len(parts) != 4 {
+			return fmt.Errorf("invalid sizes for %s, expected min:ideal:max:relax", mode)
+		}
+
+		nums := make([]int, 3)
+		for i, part := range parts[:3] {
+			n, err := strconv.Atoi(part)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid sizes for %s: %q", mode, part)
+			}
+			nums[i] = n
+		}
+		relax, err := time.ParseDuration(parts[3])
+		if err != nil || relax < 0 {
+			return fmt.Errorf("invalid relax time for %s: %q", mode, parts[3])
+		}
+
+		cfg := modes[mode]
+		sizes := &matcher.SizeConfig{Min: nums[0], Ideal: nums[1], Max: nums[2], RelaxAfter: relax}
+		if err := sizes.Validate(cfg.Teams); err != nil {
+			return fmt.Errorf("%s: %w", mode, err)
+		}
+
+		cfg.Sizes = sizes
+		modes[mode] = cfg
+	}
+	return nil
+}
+
+// parseDurations parses a comma separated list of durations, e.g. "1m,5m,1h"
+func parseDurations(s string) ([]time.Duration, error) {
+	var durations []time.Duration
+	for _, item := range strings.Split(s, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(item))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid duration %q", item)
+		}
+		durations = append(durations, d)
+	}
+	return durations, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bananalabs-oss/bananasplit/internal/catalog"
+	"github.com/bananalabs-oss/bananasplit/internal/matcher"
+	"github.com/bananalabs-oss/bananasplit/internal/queue"
+)
+
+// errNoModesFile is returned when reloading without a mode catalogue file
+var errNoModesFile = errors.New("no MODES_FILE configured, nothing to reload")
+
+// live is everything a reload changes. A reload publishes a new one whole,
+// so the queues and the matcher never see parts of two catalogue versions.
+type live struct {
+	catalog *catalog.Catalog
+	matcher *matcher.Config
+}
+
+// reloader holds the live mode catalogue and applies changes to the
+// catalogue file to the running matcher and queues
+type reloader struct {
+	mu       sync.Mutex
+	path     string           // catalogue file, empty if modes come from flags
+	settings catalog.Settings // from flags and environment, before the file
+	current  atomic.Pointer[live]
+	modTime  time.Time
+
+	queues *queue.Manager
+}
+
+func newReloader(path string, settings catalog.Settings, current *catalog.Catalog, config matcher.Config, queues *queue.Manager) *reloader {
+	r := &reloader{path: path, settings: settings, queues: queues}
+	r.current.Store(&live{catalog: current, matcher: &config})
+	if info, err := os.Stat(path); err == nil {
+		r.modTime = info.ModTime()
+	}
+	return r
+}
+
+// catalog returns the live mode catalogue
+func (r *reloader) catalog() *catalog.Catalog {
+	return r.current.Load().catalog
+}
+
+// check is the queue's mode check, always against the live catalogue
+func (r *reloader) check(mode string, size int) error {
+	return r.catalog().Check(mode, size)
+}
+
+// rules is the queue's rule source, always from the live catalogue
+func (r *reloader) rules(mode string) (queue.Rules, bool) {
+	return r.catalog().Rules(mode)
+}
+
+// matcherConfig is the matcher's config source, always the live config
+func (r *reloader) matcherConfig() matcher.ConfigSource {
+	return liveMatcherConfig{&r.current}
+}
+
+type liveMatcherConfig struct {
+	current *atomic.Pointer[live]
+}
+
+func (c liveMatcherConfig) Load() *matcher.Config {
+	return c.current.Load().matcher
+}
+
+// reload reads the catalogue file again and applies it. Nothing changes
+// unless the whole file is valid, so a bad edit keeps the running config.
+func (r *reloader) reload() (*catalog.Catalog, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.path == "" {
+		return nil, errNoModesFile
+	}
+	if info, err := os.Stat(r.path); err == nil {
+		r.modTime = info.ModTime()
+	}
+
+	next, err := catalog.Load(r.path, r.settings)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := next.Settings()
+	config := *r.current.Load().matcher
+	config.TickRate = settings.TickRate
+	config.RelayHost = settings.RelayHost
+	config.RelayPort = settings.RelayPort
+	config.Modes = next.Matching()
+
+	r.current.Store(&live{catalog: next, matcher: &config})
+	r.queues.Retier()
+
+	fmt.Printf("[Config] Reloaded %s: %d modes, tick %s, relay %s:%d\n", r.path, len(config.Modes), config.TickRate, config.RelayHost, config.RelayPort)
+	return next, nil
+}
+
+// watch reloads the catalogue file whenever its modification time changes
+func (r *reloader) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	for range ticker.C {
+		info, err := os.Stat(r.path)
+		if err != nil {
+			continue
+		}
+
+		r.mu.Lock()
+		changed := !info.ModTime().Equal(r.modTime)
+		r.mu.Unlock()
+		if !changed {
+			continue
+		}
+
+		if _, err := r.reload(); err != nil {
+			fmt.Printf("[Config] Keeping the running config, %s is invalid: %v\n", r.path, err)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/bananalabs-oss/bananasplit/internal/matcher"
+	"github.com/bananalabs-oss/bananasplit/internal/queue"
+	"github.com/goccy/go-yaml"
+)
+
+var (
+	ErrUnknownMode  = errors.New("unknown mode")
+	ErrModeDisabled = errors.New("mode is disabled")
+)
+
+// Mode holds everything configured for one mode
+type Mode struct {
+	Name         string
+	Enabled      bool
+	QueueTimeout time.Duration // how long entries may wait, 0 = forever
+	PartyMin     int           // smallest entry allowed, 1 = solo players too
+	PartyMax     int           // largest entry allowed, 0 = no limit besides the team size
+	Priority     bool          // honour priority tiers
+	MaxWait      time.Duration // how long before an entry jumps to the top tier, 0 = never
+	Match        matcher.ModeConfig
+}
+
+// Settings are the global settings a catalogue file may override. Modes
+// fall back to QueueTimeout and MaxWait.
+type Settings struct {
+	TickRate     time.Duration
+	QueueTimeout time.Duration
+	MaxWait      time.Duration
+	RelayHost    string
+	RelayPort    int
+}
+
+// Catalog is the set of modes players may queue for. An open catalogue,
+// built from command line flags, also lets players join modes it doesn't
+// list, with default settings.
+type Catalog struct {
+	modes    map[string]Mode
+	open     bool
+	settings Settings
+}
+
+// New builds an open catalogue from per-mode matching rules
+func New(modes map[string]matcher.ModeConfig, settings Settings) *Catalog {
+	c := &Catalog{modes: make(map[string]Mode, len(modes)), open: true, settings: settings}
+	for name, cfg := range modes {
+		c.modes[name] = Mode{
+			Name:         name,
+			Enabled:      true,
+			QueueTimeout: settings.QueueTimeout,
+			PartyMin:     1,
+			Priority:     true,
+			MaxWait:      settings.MaxWait,
+			Match:        cfg,
+		}
+	}
+	return c
+}
+
+// file is the layout of a catalogue file
+type file struct {
+	TickRate        *time.Duration `yaml:"tickRate"`
+	QueueTimeout    *time.Duration `yaml:"queueTimeout"`
+	PriorityMaxWait *time.Duration `yaml:"priorityMaxWait"`
+	Relay           struct {
+		Host string `yaml:"host"`
+		Port int    `yaml:"port"`
+	} `yaml:"relay"`
+	Modes map[string]modeFile `yaml:"modes"`
+}
+
+type modeFile struct {
+	Enabled      *bool          `yaml:"enabled"`
+	QueueTimeout *time.Duration `yaml:"queueTimeout"`
+	Party        struct {
+		Min int `yaml:"min"`
+		Max int `yaml:"max"`
+	} `yaml:"party"`
+	Priority struct {
+		Enabled *bool          `yaml:"enabled"`
+		MaxWait *time.Duration `yaml:"maxWait"`
+	} `yaml:"priority"`
+	Strategy   string        `yaml:"strategy"`
+	ReadyCheck time.Duration `yaml:"readyCheck"`
+	Teams      string        `yaml:"teams"`
+	Sizes      *struct {
+		Min   int           `yaml:"min"`
+		Ideal int           `yaml:"ideal"`
+		Max   int           `yaml:"max"`
+		Relax time.Duration `yaml:"relax"`
+	} `yaml:"sizes"`
+	Skill *struct {
+		Base   float64 `yaml:"base"`
+		Growth float64 `yaml:"growth"`
+		Max    float64 `yaml:"max"`
+	} `yaml:"skill"`
+}
+
+// Load reads a catalogue file. Only the modes it lists can be joined.
+// Settings the file leaves out keep the values given.
+func Load(path string, settings Settings) (*Catalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, settings)
+}
+
+// Parse reads a catalogue from YAML. It checks everything, so a catalogue
+// it returns can be applied as a whole.
+func Parse(data []byte, settings Settings) (*Catalog, error) {
+	var f file
+	if err := yaml.UnmarshalWithOptions(data, &f, yaml.DisallowUnknownField()); err != nil {
+		return nil, err
+	}
+	if len(f.Modes) == 0 {
+		return nil, errors.New("no modes defined")
+	}
+
+	if f.TickRate != nil {
+		settings.TickRate = *f.TickRate
+	}
+	if f.QueueTimeout != nil {
+		settings.QueueTimeout = *f.QueueTimeout
+	}
+	if f.PriorityMaxWait != nil {
+		settings.MaxWait = *f.PriorityMaxWait
+	}
+	if f.Relay.Host != "" {
+		settings.RelayHost = f.Relay.Host
+	}
+	if f.Relay.Port != 0 {
+		settings.RelayPort = f.Relay.Port
+	}
+	if settings.TickRate <= 0 || settings.QueueTimeout < 0 || settings.MaxWait < 0 {
+		return nil, errors.New("invalid durations, tickRate must be positive and the others not negative")
+	}
+	if settings.RelayPort < 1 || settings.RelayPort > 65535 {
+		return nil, fmt.Errorf("invalid relay port %d", settings.RelayPort)
+	}
+
+	c := &Catalog{modes: make(map[string]Mode, len(f.Modes)), settings: settings}
+	for name, mf := range f.Modes {
+		mode, err := mf.resolve(name, settings)
+		if err != nil {
+			return nil, fmt.Errorf("mode %s: %w", name, err)
+		}
+		c.modes[name] = mode
+	}
+	return c, nil
+}
+
+// resolve checks a mode's settings and fills in the defaults
+func (mf modeFile) resolve(name string, defaults Settings) (Mode, error) {
+	mode := Mode{
+		Name:         name,
+		Enabled:      mf.Enabled == nil || *mf.Enabled,
+		QueueTimeout: defaults.QueueTimeout,
+		PartyMin:     max(mf.Party.Min, 1),
+		PartyMax:     mf.Party.Max,
+		Priority:     mf.Priority.Enabled == nil || *mf.Priority.Enabled,
+		MaxWait:      defaults.MaxWait,
+		Match: matcher.ModeConfig{
+			Strategy:   mf.Strategy,
+			ReadyCheck: mf.ReadyCheck,
+		},
+	}
+	if mf.QueueTimeout != nil {
+		mode.QueueTimeout = *mf.QueueTimeout
+	}
+	if mf.Priority.MaxWait != nil {
+		mode.MaxWait = *mf.Priority.MaxWait
+	}
+
+	if mode.QueueTimeout < 0 || mode.MaxWait < 0 || mode.Match.ReadyCheck < 0 {
+		return Mode{}, errors.New("durations can't be negative")
+	}
+	if mf.Party.Min < 0 || mf.Party.Max < 0 || (mode.PartyMax > 0 && mode.PartyMax < mode.PartyMin) {
+		return Mode{}, errors.New("invalid party sizes, expected 1 <= min <= max")
+	}
+
+	if mf.Teams != "" {
+		layout, err := matcher.ParseTeamLayout(mf.Teams)
+		if err != nil {
+			return Mode{}, err
+		}
+		if mode.PartyMin > layout.Largest() {
+			return Mode{}, fmt.Errorf("parties of %d don't fit on a %s team", mode.PartyMin, layout)
+		}
+		mode.Match.Teams = layout
+	}
+	if mf.Sizes != nil {
+		sizes := &matcher.SizeConfig{Min: mf.Sizes.Min, Ideal: mf.Sizes.Ideal, Max: mf.Sizes.Max, RelaxAfter: mf.Sizes.Relax}
+		if err := sizes.Validate(mode.Match.Teams); err != nil {
+			return Mode{}, err
+		}
+		mode.Match.Sizes = sizes
+	}
+	if mf.Skill != nil {
+		if mf.Skill.Base < 0 || mf.Skill.Growth < 0 || mf.Skill.Max < 0 {
+			return Mode{}, errors.New("skill windows can't be negative")
+		}
+		mode.Match.Skill = &matcher.SkillConfig{BaseWindow: mf.Skill.Base, Growth: mf.Skill.Growth, MaxWindow: mf.Skill.Max}
+	}
+	if _, err := matcher.NewStrategy(mode.Match); err != nil {
+		return Mode{}, err
+	}
+	return mode, nil
+}
+
+// Check reports whether an entry of size players may join a mode. It has
+// the queue.ModeCheck signature.
+func (c *Catalog) Check(name string, size int) error {
+	mode, ok := c.modes[name]
+	if !ok {
+		if c.open {
+			return nil
+		}
+		return fmt.Errorf("%w %q", ErrUnknownMode, name)
+	}
+	if !mode.Enabled {
+		return fmt.Errorf("%s: %w", name, ErrModeDisabled)
+	}
+
+	// Parties always play on the same team
+	largest := mode.PartyMax
+	if teams := mode.Match.Teams; teams != nil && (largest == 0 || teams.Largest() < largest) {
+		largest = teams.Largest()
+	}
+	if size < mode.PartyMin || (largest > 0 && size > largest) {
+		if largest == 0 {
+			return fmt.Errorf("%s needs parties of at least %d", name, mode.PartyMin)
+		}
+		return fmt.Errorf("%s takes parties of %d to %d players, not %d", name, mode.PartyMin, largest, size)
+	}
+	return nil
+}
+
+// Get returns a listed mode
+func (c *Catalog) Get(name string) (Mode, bool) {
+	mode, ok := c.modes[name]
+	return mode, ok
+}
+
+// Settings returns the global settings, with any overrides from the file
+func (c *Catalog) Settings() Settings {
+	return c.settings
+}
+
+// Open reports whether modes the catalogue doesn't list may be joined
+func (c *Catalog) Open() bool {
+	return c.open
+}
+
+// List returns every listed mode, ordered by name
+func (c *Catalog) List() []Mode {
+	list := make([]Mode, 0, len(c.modes))
+	for _, mode := range c.modes {
+		list = append(list, mode)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Matching returns the matching rules of every listed mode
+func (c *Catalog) Matching() map[string]matcher.ModeConfig {
+	modes := make(map[string]matcher.ModeConfig, len(c.modes))
+	for name, mode := range c.modes {
+		modes[name] = mode.Match
+	}
+	return modes
+}
+
+// Rules returns the queue rules of a listed mode. It has the
+// queue.RuleSource signature.
+func (c *Catalog) Rules(name string) (queue.Rules, bool) {
+	mode, ok := c.modes[name]
+	if !ok {
+		return queue.Rules{}, false
+	}
+	return queue.Rules{
+		Timeout: mode.QueueTimeout,
+		MaxWait: mode.MaxWait,
+		Flat:    !mode.Priority,
+	}, true
+}
@@ -0,0 +1,144 @@
+package catalog
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bananalabs-oss/bananasplit/internal/matcher"
+)
+
+var defaults = Settings{
+	TickRate:     500 * time.Millisecond,
+	QueueTimeout: 5 * time.Minute,
+	MaxWait:      2 * time.Minute,
+	RelayHost:    "hycraft.net",
+	RelayPort:    5520,
+}
+
+func TestParseRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string // part of the error
+	}{
+		{"no modes", "tickRate: 1s", "no modes"},
+		{"unknown key", "modes: {sw: {}}\nfoo: 1", "foo"},
+		{"unknown mode key", "modes: {sw: {teamz: 2x2}}", "teamz"},
+		{"zero tick rate", "tickRate: 0s\nmodes: {sw: {}}", "invalid durations"},
+		{"negative queue timeout", "queueTimeout: -1s\nmodes: {sw: {}}", "invalid durations"},
+		{"negative max wait", "priorityMaxWait: -1s\nmodes: {sw: {}}", "invalid durations"},
+		{"negative mode queue timeout", "modes: {sw: {queueTimeout: -1s}}", "negative"},
+		{"negative ready check", "modes: {sw: {readyCheck: -5s}}", "negative"},
+		{"negative mode max wait", "modes: {sw: {priority: {maxWait: -1m}}}", "negative"},
+		{"relay port too high", "relay: {port: 70000}\nmodes: {sw: {}}", "relay port"},
+		{"negative relay port", "relay: {port: -1}\nmodes: {sw: {}}", "relay port"},
+		{"party max below min", "modes: {sw: {party: {min: 3, max: 2}}}", "party sizes"},
+		{"negative party size", "modes: {sw: {party: {min: -1}}}", "party sizes"},
+		{"party bigger than a team", "modes: {sw: {teams: 2x2, party: {min: 3}}}", "don't fit"},
+		{"bad team layout", "modes: {sw: {teams: 4}}", "team layout"},
+		{"sizes out of order", "modes: {sw: {sizes: {min: 8, ideal: 4}}}", "invalid sizes"},
+		{"min size below the team count", "modes: {sw: {teams: 2x2x2x2, sizes: {min: 3, ideal: 8}}}", "teams empty"},
+		{"negative skill window", "modes: {sw: {skill: {base: -1}}}", "negative"},
+		{"unknown strategy", "modes: {sw: {strategy: elo}}", "unknown strategy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.yaml), defaults)
+			if err == nil {
+				t.Fatal("parsed")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error %q doesn't mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOverridesSettings(t *testing.T) {
+	c, err := Parse([]byte(`
+tickRate: 250ms
+queueTimeout: 1m
+relay: {host: relay.example, port: 6000}
+modes:
+  sw: {}
+  ranked: {queueTimeout: 0s, priority: {enabled: false}}
+`), defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := c.Settings()
+	want := Settings{TickRate: 250 * time.Millisecond, QueueTimeout: time.Minute, MaxWait: 2 * time.Minute, RelayHost: "relay.example", RelayPort: 6000}
+	if settings != want {
+		t.Errorf("settings %+v, want %+v", settings, want)
+	}
+
+	sw, _ := c.Get("sw")
+	if !sw.Enabled || sw.QueueTimeout != time.Minute || sw.MaxWait != 2*time.Minute || sw.PartyMin != 1 || !sw.Priority {
+		t.Errorf("sw didn't get the defaults: %+v", sw)
+	}
+	ranked, _ := c.Get("ranked")
+	if ranked.QueueTimeout != 0 || ranked.Priority {
+		t.Errorf("ranked overrides were lost: %+v", ranked)
+	}
+	if rules, _ := c.Rules("ranked"); !rules.Flat || rules.Timeout != 0 {
+		t.Errorf("ranked rules %+v, want flat without timeout", rules)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	c, err := Parse([]byte(`
+modes:
+  sw: {}
+  off: {enabled: false}
+  duos: {teams: 2x2, party: {max: 4}}
+  squads: {party: {min: 2, max: 4}}
+`), defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		mode string
+		size int
+		want error // nil, a sentinel, or errAny for any other error
+	}{
+		{"sw", 1, nil},
+		{"sw", 8, nil},
+		{"nope", 1, ErrUnknownMode},
+		{"off", 1, ErrModeDisabled},
+		{"duos", 2, nil},
+		{"duos", 3, errAny}, // parties stay on one team of 2
+		{"squads", 1, errAny},
+		{"squads", 4, nil},
+		{"squads", 5, errAny},
+	}
+
+	for _, tt := range tests {
+		err := c.Check(tt.mode, tt.size)
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%s with %d: %v", tt.mode, tt.size, err)
+			}
+			continue
+		}
+		if err == nil || (tt.want != errAny && !errors.Is(err, tt.want)) {
+			t.Errorf("%s with %d: got %v, want %v", tt.mode, tt.size, err, tt.want)
+		}
+	}
+}
+
+func TestOpenCatalogAcceptsUnlistedModes(t *testing.T) {
+	c := New(map[string]matcher.ModeConfig{"ranked": {}}, defaults)
+	if err := c.Check("anything", 3); err != nil {
+		t.Fatalf("open catalogue rejected an unlisted mode: %v", err)
+	}
+	if _, ok := c.Rules("anything"); ok {
+		t.Fatal("unlisted mode has rules")
+	}
+}
+
+var errAny = errors.New("any error")
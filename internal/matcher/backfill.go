@@ -0,0 +1,127 @@
+package matcher
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/bananalabs-oss/bananasplit/internal/queue"
+	"github.com/bananalabs-oss/potassium/registry"
+)
+
+// ErrNotGameServer is returned when backfill is requested for a server that
+// isn't a game server
+var ErrNotGameServer = errors.New("not a game server")
+
+// backfill is a running match advertising open player slots
+type backfill struct {
+	serverID string
+	matchID  string
+	mode     string
+	slots    int
+}
+
+// OpenBackfill advertises open slots in a running match. The matcher fills
+// them from the match's mode queue ahead of fresh matches. Calling it again
+// replaces the slot count; 0 slots closes the backfill. Returns the mode.
+func (m *Matcher) OpenBackfill(serverID string, matchID string, slots int) (string, error) {
+	if slots <= 0 {
+		m.CloseBackfill(serverID, matchID)
+		return "", nil
+	}
+
+	server, err := m.GetServer(serverID)
+	if err != nil {
+		return "", err
+	}
+	if server.Type != registry.TypeGame {
+		return "", ErrNotGameServer
+	}
+
+	m.backfillMu.Lock()
+	m.backfills[serverID+"/"+matchID] = &backfill{
+		serverID: serverID,
+		matchID:  matchID,
+		mode:     server.Mode,
+		slots:    slots,
+	}
+	m.backfillMu.Unlock()
+
+	fmt.Printf("[Matcher] Backfill open on %s/%s: %d slots for %s\n", serverID, matchID, slots, server.Mode)
+	return server.Mode, nil
+}
+
+// CloseBackfill stops filling a match's open slots
+func (m *Matcher) CloseBackfill(serverID string, matchID string) bool {
+	m.backfillMu.Lock()
+	defer m.backfillMu.Unlock()
+
+	key := serverID + "/" + matchID
+	_, ok := m.backfills[key]
+	delete(m.backfills, key)
+	return ok
+}
+
+// findBackfills returns every match in a mode with open slots, ordered by
+// server and match ID
+func (m *Matcher) findBackfills(mode string) []ReadyMatch {
+	m.backfillMu.Lock()
+	defer m.backfillMu.Unlock()
+
+	var open []ReadyMatch
+	for _, b := range m.backfills {
+		if b.mode != mode || b.slots <= 0 || m.coolingDown(b.serverID, b.matchID) {
+			continue
+		}
+
+		server, ok := m.servers.Get(b.serverID)
+		if !ok {
+			continue
+		}
+		open = append(open, ReadyMatch{
+			Server:   server,
+			MatchID:  b.matchID,
+			Need:     b.slots,
+			Backfill: true,
+		})
+	}
+
+	sort.Slice(open, func(i, j int) bool {
+		if open[i].Server.ID != open[j].Server.ID {
+			return open[i].Server.ID < open[j].Server.ID
+		}
+		return open[i].MatchID < open[j].MatchID
+	})
+	return open
+}
+
+// adjustBackfill changes a match's open slot count by delta, if its
+// backfill is still open
+func (m *Matcher) adjustBackfill(serverID string, matchID string, delta int) {
+	m.backfillMu.Lock()
+	defer m.backfillMu.Unlock()
+
+	if b, ok := m.backfills[serverID+"/"+matchID]; ok {
+		b.slots = max(b.slots+delta, 0)
+	}
+}
+
+// fillOpenSlots returns a Selector that takes entries in FIFO order while
+// they fit into n slots. Unlike Fill it settles for fewer than n players,
+// since a running match is better off with some of its slots filled.
+func fillOpenSlots(n int) queue.Selector {
+	return func(entries []queue.QueueEntry) []int {
+		var picked []int
+		remaining := n
+		for i, entry := range entries {
+			if remaining == 0 {
+				break
+			}
+			if entry.Size() <= remaining {
+				picked = append(picked, i)
+				remaining -= entry.Size()
+			}
+		}
+		return picked
+	}
+}
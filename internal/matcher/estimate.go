@@ -0,0 +1,19 @@
+package matcher
+
+import "time"
+
+// EstimateWait guesses how long until a mode's queue has matched position
+// more players, from how many it sent to matches over the throughput
+// window. Returns false if the mode matched nobody in that time.
+func (m *Matcher) EstimateWait(mode string, position int) (time.Duration, bool) {
+	window := m.config.Load().ThroughputWindow
+	if window <= 0 {
+		return 0, false
+	}
+
+	sent := m.matches.Sent(mode, time.Now().Add(-window))
+	if sent == 0 {
+		return 0, false
+	}
+	return window * time.Duration(position) / time.Duration(sent), true
+}
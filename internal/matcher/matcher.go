@@ -5,33 +5,74 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/bananalabs-oss/bananasplit/internal/matches"
+	"github.com/bananalabs-oss/bananasplit/internal/penalties"
 	"github.com/bananalabs-oss/bananasplit/internal/players"
 	"github.com/bananalabs-oss/bananasplit/internal/queue"
 	"github.com/bananalabs-oss/bananasplit/internal/referrals"
+	"github.com/bananalabs-oss/bananasplit/internal/registryview"
 	"github.com/bananalabs-oss/potassium/registry"
 	"github.com/bananalabs-oss/potassium/relay"
 )
 
 // Config holds matcher configuration
 type Config struct {
-	RegistryURL string // Bananagine registry URL
-	TickRate    time.Duration
+	RegistryURL   string // Bananagine registry URL
+	TickRate      time.Duration
+	MatchCooldown time.Duration // How long to skip a match after assigning to it failed
+
+	ArrivalTimeout time.Duration // How long matched players have to reach the game server, 0 or less = disabled
+	NoShowAction   NoShowAction  // What to do with players who never arrive
+	TimeoutAction  TimeoutAction // What to do with players whose queue entry timed out
 
 	RelayHost string
 	RelayPort int
+
+	ThroughputWindow time.Duration // How far back wait estimates look at matched players
+
+	Modes map[string]ModeConfig // Per-mode overrides, keyed by mode
+}
+
+// ModeConfig holds matching rules for a single mode
+type ModeConfig struct {
+	Strategy   string        // Registered strategy name, empty = skill if configured, else FIFO
+	Skill      *SkillConfig  // Rating window for the skill strategy
+	ReadyCheck time.Duration // How long players have to accept a match, 0 = no ready check
+	Teams      TeamLayout    // Team sizes, nil = no teams
+	Sizes      *SizeConfig   // Player count range, nil = exactly what the game server asks for
+}
+
+// ConfigSource returns the configuration in effect. A source may return a
+// new configuration at any time, but never changes one it returned.
+type ConfigSource interface {
+	Load() *Config
 }
 
 // Matcher checks queues and assigns players to servers
 type Matcher struct {
-	config Config
+	config ConfigSource
 	queues *queue.Manager
 	client *http.Client
 
 	players   *players.Registry
 	referrals *referrals.Queue
 	peel      *relay.Client
+	matches   *matches.Store
+	servers   *registryview.View
+	penalties *penalties.Tracker
+
+	cooldowns map[string]time.Time // "server/match" → skip until, only used by the tick loop
+
+	checksMu sync.Mutex
+	checks   map[string]*readyCheck // key = match record ID
+
+	backfillMu sync.Mutex
+	backfills  map[string]*backfill // "server/match" → open slots
 }
 
 // TransferRequest is sent to lobby servers
@@ -43,16 +84,18 @@ type TransferRequest struct {
 
 // ExpectRequest is sent to game servers
 type ExpectRequest struct {
-	MatchID string   `json:"matchId"`
-	UUIDs   []string `json:"uuids"`
+	MatchID string     `json:"matchId"`
+	UUIDs   []string   `json:"uuids"`
+	Teams   [][]string `json:"teams,omitempty"`
 }
 
 // MatchReadyRequest is sent to lobby servers to trigger transfers
 type MatchReadyRequest struct {
-	MatchID    string   `json:"matchId"`
-	Mode       string   `json:"mode"`
-	Players    []string `json:"players"`
-	GameServer string   `json:"gameServer"` // host:port of game server
+	MatchID    string     `json:"matchId"`
+	Mode       string     `json:"mode"`
+	Players    []string   `json:"players"`
+	Teams      [][]string `json:"teams,omitempty"` // every team in the match, not just this lobby's players
+	GameServer string     `json:"gameServer"`      // host:port of game server
 }
 
 // New creates a new matcher
@@ -61,23 +104,59 @@ func New(
 	queues *queue.Manager,
 	playerRegistry *players.Registry,
 	referralQueue *referrals.Queue,
-	peelClient *relay.Client) *Matcher {
-	return &Matcher{
-		config:    config,
+	peelClient *relay.Client,
+	matchStore *matches.Store,
+	serverView *registryview.View,
+	penaltyTracker *penalties.Tracker) *Matcher {
+	m := &Matcher{
 		queues:    queues,
 		players:   playerRegistry,
 		referrals: referralQueue,
 		peel:      peelClient,
+		matches:   matchStore,
+		servers:   serverView,
+		penalties: penaltyTracker,
 		client:    &http.Client{Timeout: 5 * time.Second},
+		cooldowns: make(map[string]time.Time),
+		checks:    make(map[string]*readyCheck),
+		backfills: make(map[string]*backfill),
 	}
+	fixed := &atomic.Pointer[Config]{}
+	fixed.Store(&config)
+	m.config = fixed
+	return m
+}
+
+// SetConfigSource makes the matcher read its configuration from source
+// instead of the one given to New, so it can change while running. Call it
+// before Start.
+func (m *Matcher) SetConfigSource(source ConfigSource) {
+	m.config = source
+}
+
+// Config returns the current configuration
+func (m *Matcher) Config() Config {
+	return *m.config.Load()
 }
 
-// Start begins the matching loop
+// Start begins the matching loop. Besides the regular tick, a cycle also
+// runs as soon as the registry view refreshes. A new tick rate from the
+// config source takes effect after the next tick.
 func (m *Matcher) Start() {
-	ticker := time.NewTicker(m.config.TickRate)
+	rate := m.config.Load().TickRate
+	ticker := time.NewTicker(rate)
 	go func() {
-		for range ticker.C {
+		for {
+			select {
+			case <-ticker.C:
+			case <-m.servers.Updates():
+			}
 			m.tick()
+
+			if next := m.config.Load().TickRate; next != rate {
+				rate = next
+				ticker.Reset(rate)
+			}
 		}
 	}()
 }
@@ -87,96 +166,381 @@ func (m *Matcher) tick() {
 	modes := m.queues.Modes()
 
 	for _, mode := range modes {
+		if m.queues.IsPaused(mode) {
+			continue
+		}
 		m.tryMatch(mode)
 	}
+
+	m.checkReadyChecks()
+
+	if m.config.Load().ArrivalTimeout > 0 {
+		m.checkArrivals()
+	}
 }
 
 // tryMatch attempts to match players for a game mode
 func (m *Matcher) tryMatch(mode string) {
-	// Find a ready server/match
-	server, matchID, found := m.findReadyMatch(mode)
-	if !found {
+	// Open backfill slots go first, then every ready server/match
+	ready := append(m.findBackfills(mode), m.findReadyMatches(mode)...)
+	if len(ready) == 0 {
+		return
+	}
+
+	entries := m.queues.Entries(mode)
+	if len(entries) == 0 {
 		return
 	}
 
-	// Check queue size
-	match := server.Matches[matchID]
-	needed := match.Need
-	queueSize := m.queues.Size(mode)
+	cfg := m.config.Load().Modes[mode]
+	strategy, err := NewStrategy(cfg)
+	if err != nil {
+		fmt.Printf("[Matcher] %s: %v\n", mode, err)
+		return
+	}
+
+	// Size each match by how long the oldest entry has waited
+	if cfg.Sizes != nil {
+		waited := time.Since(oldest(entries))
+		for i := range ready {
+			if !ready[i].Backfill {
+				ready[i].Min, ready[i].Need = cfg.Sizes.Range(ready[i].Need, waited)
+			}
+		}
+	}
+
+	for _, assignment := range strategy.Assign(mode, entries, ready) {
+		if !validAssignment(assignment) {
+			fmt.Printf("[Matcher] %s: strategy returned an invalid assignment for %s/%s\n", mode, assignment.Match.Server.ID, assignment.Match.MatchID)
+			continue
+		}
+
+		// Split the players into teams, keeping parties together
+		if layout := cfg.Teams; layout != nil && assignment.Teams == nil && !assignment.Match.Backfill {
+			assignment.Teams = formTeams(assignment.Entries, layout.Split(assignment.Size()))
+			if assignment.Teams == nil {
+				fmt.Printf("[Matcher] %s: can't form %s teams for %s/%s\n", mode, layout, assignment.Match.Server.ID, assignment.Match.MatchID)
+				continue
+			}
+		}
+
+		// Remove the players from the queue, unless someone left meanwhile
+		if !m.queues.Take(mode, assignment.Entries) {
+			continue
+		}
+
+		m.assign(mode, cfg, assignment)
+	}
+}
+
+// validAssignment checks that an assignment fills its match with a player
+// count it allows, or fits into a backfill's open slots
+func validAssignment(assignment Assignment) bool {
+	size := assignment.Size()
+	fewest := assignment.Match.Need
+	if assignment.Match.Backfill {
+		fewest = 1
+	} else if assignment.Match.Min > 0 {
+		fewest = assignment.Match.Min
+	}
+	return size >= max(fewest, 1) && size <= assignment.Match.Need
+}
 
-	if queueSize < needed {
+// oldest returns when the longest-waiting entry joined
+func oldest(entries []queue.QueueEntry) time.Time {
+	first := entries[0].JoinedAt
+	for _, entry := range entries {
+		if entry.JoinedAt.Before(first) {
+			first = entry.JoinedAt
+		}
+	}
+	return first
+}
+
+// assign sends an assignment's players to its match, after a ready check if
+// the mode has one. Backfills skip the ready check, since their match is
+// already running. The entries must already be removed from the queue; on
+// failure they are put back. cfg is the mode's config the match was made
+// under.
+func (m *Matcher) assign(mode string, cfg ModeConfig, assignment Assignment) {
+	server := assignment.Match.Server
+	matchID := assignment.Match.MatchID
+
+	if assignment.Match.Backfill {
+		record := m.matches.CreateBackfill(mode, server.ID, matchID, assignment.Entries)
+		m.adjustBackfill(server.ID, matchID, -len(record.Players))
+		fmt.Printf("[Matcher] Backfilling %d players for %s on %s/%s (match %s)\n", len(record.Players), mode, server.ID, matchID, record.ID)
+
+		m.commit(record, assignment, false)
 		return
 	}
 
-	// Pop players from queue
-	players := m.queues.Pop(mode, needed)
-	if players == nil {
+	record := m.matches.Create(mode, server.ID, matchID, server.Matches[matchID].Need, assignment.Entries, assignment.Teams)
+	fmt.Printf("[Matcher] Matched %d players for %s on %s/%s (match %s)\n", len(record.Players), mode, server.ID, matchID, record.ID)
+
+	if timeout := cfg.ReadyCheck; timeout > 0 {
+		m.startReadyCheck(record, assignment, timeout)
 		return
 	}
 
-	fmt.Printf("[Matcher] Matched %d players for %s on %s/%s\n", len(players), mode, server.ID, matchID)
+	m.commit(record, assignment, false)
+}
 
-	// Collect UIDs
-	uuids := make([]string, len(players))
-	for i, p := range players {
-		uuids[i] = p.UUID
+// commit tells the game server to expect the players, marks the match busy
+// and has the lobbies transfer them. reserved is true if the match was
+// already taken out of the ready pool for a ready check.
+func (m *Matcher) commit(record matches.Match, assignment Assignment, reserved bool) {
+	server := assignment.Match.Server
+	matchID := assignment.Match.MatchID
+	players := assignment.Entries
+	uuids := record.Players
+
+	// A match cancelled meanwhile, such as by an operator during its ready
+	// check, never starts. Its slot was freed by the cancel.
+	if _, err := m.matches.Transition(record.ID, matches.StateExpecting); err != nil {
+		m.queues.PushFront(record.Mode, players...)
+		fmt.Printf("[Matcher] Match %s not started, returned %d entries to %s queue: %v\n", record.ID, len(players), record.Mode, err)
+		return
 	}
 
 	// Tell game server to expect players
-	m.sendExpect(server, matchID, uuids)
+	if err := m.sendExpect(server, matchID, uuids, record.Teams); err != nil {
+		m.rollback(record, players, reserved, err)
+		return
+	}
 
-	// Update match status to busy
-	m.updateMatchStatus(server.ID, matchID, registry.StatusBusy, uuids)
+	// Update match status to busy. A backfilled match already is, and the
+	// game server keeps its own player list.
+	if !record.Backfill {
+		if err := m.updateMatchStatus(server.ID, matchID, registry.StatusBusy, uuids); err != nil {
+			m.rollback(record, players, reserved, err)
+			return
+		}
+	}
 
 	// Notify lobbies to transfer players
-	m.notifyLobbies(players, server, matchID, mode)
+	m.matches.Transition(record.ID, matches.StateTransferring)
+	m.notifyLobbies(players, server, matchID, record.Mode, record.Teams)
+}
+
+// rollback returns popped players to the front of the queue, keeping their
+// original JoinedAt, cancels the match record and puts the match on cooldown
+func (m *Matcher) rollback(record matches.Match, players []queue.QueueEntry, reserved bool, cause error) {
+	m.queues.PushFront(record.Mode, players...)
+	m.matches.Transition(record.ID, matches.StateCancelled)
+	m.cooldowns[record.ServerID+"/"+record.MatchID] = time.Now().Add(m.config.Load().MatchCooldown)
+	if reserved {
+		m.release(record)
+	}
+	if record.Backfill {
+		m.adjustBackfill(record.ServerID, record.MatchID, len(record.Players))
+	}
+
+	fmt.Printf("[Matcher] Match %s/%s failed, returned %d entries to %s queue: %v\n", record.ServerID, record.MatchID, len(players), record.Mode, cause)
+}
+
+// RequeuePriority returns the tier for an entry put back in the queue after
+// its match: requeue, or the entry's own tier if higher. Players with recent
+// offenses go back at low, as they would join.
+func (m *Matcher) RequeuePriority(entry queue.QueueEntry) queue.Priority {
+	if m.penalties.Penalized(entry.Players()) {
+		return queue.PriorityLow
+	}
+	return entry.Priority.AtLeast(queue.PriorityRequeue)
+}
+
+// release puts a match back in the registry's ready pool
+func (m *Matcher) release(record matches.Match) {
+	match := registry.MatchInfo{Status: registry.StatusReady, Need: record.Need}
+	if err := m.putMatch(record.ServerID, record.MatchID, match); err != nil {
+		fmt.Printf("[Matcher] Failed to release %s/%s: %v\n", record.ServerID, record.MatchID, err)
+	}
+}
+
+// coolingDown reports whether a match is being skipped after a failure
+func (m *Matcher) coolingDown(serverID string, matchID string) bool {
+	key := serverID + "/" + matchID
+	until, ok := m.cooldowns[key]
+	if !ok {
+		return false
+	}
+	if time.Now().After(until) {
+		delete(m.cooldowns, key)
+		return false
+	}
+	return true
 }
 
 // notifyLobbies tells lobby servers to transfer matched players
-func (m *Matcher) notifyLobbies(players []queue.QueueEntry, server registry.ServerInfo, matchID string, mode string) { // Group players by their lobby server
+func (m *Matcher) notifyLobbies(players []queue.QueueEntry, server registry.ServerInfo, matchID string, mode string, teams [][]string) {
+	backend := fmt.Sprintf("%s:%d", server.Host, server.Port)
+
+	m.postToLobbies(players, "/match", func(uuids []string) interface{} {
+		return MatchReadyRequest{
+			MatchID:    matchID,
+			Mode:       mode,
+			Players:    uuids,
+			Teams:      teams,
+			GameServer: backend,
+		}
+	})
+}
+
+// postToLobbies groups players by their lobby server and POSTs the payload
+// built for each group to that lobby's webhook path
+func (m *Matcher) postToLobbies(players []queue.QueueEntry, path string, payload func(uuids []string) interface{}) {
 	lobbies := make(map[string][]string)
 	for _, p := range players {
-		lobbies[p.LobbyServer] = append(lobbies[p.LobbyServer], p.UUID)
+		lobbies[p.LobbyServer] = append(lobbies[p.LobbyServer], p.Players()...)
 	}
 
-	backend := fmt.Sprintf("%s:%d", server.Host, server.Port)
-
 	for lobbyID, uuids := range lobbies {
 		// Get lobby info from registry
-		lobbyURL := fmt.Sprintf("%s/registry/servers/%s", m.config.RegistryURL, lobbyID)
-		resp, err := m.client.Get(lobbyURL)
+		lobby, err := m.GetServer(lobbyID)
 		if err != nil {
 			fmt.Printf("[Matcher] Failed to get lobby %s: %v\n", lobbyID, err)
 			continue
 		}
 
-		var lobby registry.ServerInfo
-		if err := json.NewDecoder(resp.Body).Decode(&lobby); err != nil {
-			resp.Body.Close()
-			fmt.Printf("[Matcher] Failed to decode lobby %s: %v\n", lobbyID, err)
+		// POST to lobby's webhook
+		webhookURL := fmt.Sprintf("http://%s:%d%s", lobby.Host, lobby.WebhookPort, path)
+		body, _ := json.Marshal(payload(uuids))
+		resp, err := m.client.Post(webhookURL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			fmt.Printf("[Matcher] Failed to notify lobby %s: %v\n", lobbyID, err)
 			continue
 		}
 		resp.Body.Close()
 
-		// POST to lobby's /match webhook
-		webhookURL := fmt.Sprintf("http://%s:%d/match", lobby.Host, lobby.WebhookPort)
-		payload := MatchReadyRequest{
-			MatchID:    matchID,
-			Mode:       mode,
-			Players:    uuids,
-			GameServer: backend,
+		fmt.Printf("[Matcher] Notified lobby %s (%s) for %d players\n", lobbyID, path, len(uuids))
+	}
+}
+
+// CancelMatch cancels a live match, frees its slot in the registry and sends
+// any players already on the game server back to a lobby, including players
+// who backfilled it. A match still in its ready check is dropped, and its
+// players go back to the front of the queue.
+func (m *Matcher) CancelMatch(id string) (matches.Match, error) {
+	record, ok := m.matches.Get(id)
+	if !ok {
+		return matches.Match{}, matches.ErrNotFound
+	}
+
+	var backfills []matches.Match
+	if !record.Backfill {
+		backfills = m.matches.Backfills(record.ServerID, record.MatchID)
+	}
+
+	match, err := m.cancel(id)
+	if err != nil {
+		return match, err
+	}
+
+	if check := m.dropReadyCheck(id); check != nil {
+		m.queues.PushFront(match.Mode, check.assignment.Entries...)
+		fmt.Printf("[Matcher] Dropped ready check for match %s, returned %d entries to %s queue\n", id, len(check.assignment.Entries), match.Mode)
+	}
+
+	for _, b := range append(backfills, match) {
+		for _, uuid := range b.Players {
+			m.sendHome(b, uuid)
 		}
+	}
+	return match, nil
+}
 
-		body, _ := json.Marshal(payload)
-		resp, err = m.client.Post(webhookURL, "application/json", bytes.NewReader(body))
-		if err != nil {
-			fmt.Printf("[Matcher] Failed to notify lobby %s: %v\n", lobbyID, err)
-			continue
+// cancel marks a match cancelled and frees its slot in the registry. A
+// cancelled backfill reopens the slots of players who never arrived; a
+// cancelled match stops being backfilled.
+func (m *Matcher) cancel(id string) (matches.Match, error) {
+	match, err := m.matches.Transition(id, matches.StateCancelled)
+	if err != nil {
+		return match, err
+	}
+
+	if match.Backfill {
+		m.adjustBackfill(match.ServerID, match.MatchID, len(match.Missing()))
+	} else {
+		m.CloseBackfill(match.ServerID, match.MatchID)
+		m.release(match)
+	}
+
+	fmt.Printf("[Matcher] Cancelled match %s on %s/%s\n", match.ID, match.ServerID, match.MatchID)
+	return match, nil
+}
+
+// CancelUnstarted cancels matches restored from a snapshot that never got
+// as far as transferring their players. Ready checks and pending
+// assignments only live in memory, so nothing would ever finish them after
+// a restart. Their slots are freed and their players go back to the front
+// of the queue. Call it once after restoring, before Start.
+func (m *Matcher) CancelUnstarted() {
+	for _, state := range []matches.State{matches.StateCreated, matches.StateAccepting, matches.StateExpecting} {
+		for _, record := range m.matches.List(state, "") {
+			match, err := m.cancel(record.ID)
+			if err != nil {
+				continue
+			}
+
+			entries := match.Regroup(match.Players)
+			m.queues.PushFront(match.Mode, entries...)
+			fmt.Printf("[Matcher] Match %s was %s at shutdown, returned %d entries to %s queue\n", match.ID, state, len(entries), match.Mode)
 		}
-		resp.Body.Close()
+	}
+}
+
+// sendHome routes a player who is on the match's game server back to a
+// lobby, preferring the one they queued from. Returns the lobby ID, or false
+// if the player isn't on the game server or no lobby is available.
+func (m *Matcher) sendHome(match matches.Match, uuid string) (string, bool) {
+	player, found := m.players.GetByUUID(uuid)
+	if !found || player.ServerID != match.ServerID {
+		return "", false
+	}
+
+	lobby, ok := m.LobbyFor(match.Lobbies[uuid])
+	if !ok {
+		return "", false
+	}
+
+	m.ReturnToLobby(match.ServerID, uuid, lobby)
+	return lobby.ID, true
+}
+
+// LobbyFor returns the given lobby if it still has room, otherwise any lobby
+// with capacity
+func (m *Matcher) LobbyFor(lobbyID string) (registry.ServerInfo, bool) {
+	if lobbyID != "" {
+		lobby, err := m.GetServer(lobbyID)
+		if err == nil && (lobby.MaxPlayers == 0 || lobby.Players < lobby.MaxPlayers) {
+			return lobby, true
+		}
+	}
+	return m.FindLobby()
+}
+
+// ReturnToLobby routes a player to a lobby and queues a referral on the
+// server they are currently on
+func (m *Matcher) ReturnToLobby(serverID string, playerUUID string, lobby registry.ServerInfo) {
+	player, found := m.players.GetByUUID(playerUUID)
+	if !found {
+		fmt.Printf("[Matcher] Player %s not in registry\n", playerUUID)
+		return
+	}
 
-		fmt.Printf("[Matcher] Notified lobby %s to transfer %d players to %s\n", lobbyID, len(uuids), backend)
+	backend := fmt.Sprintf("%s:%d", lobby.Host, lobby.Port)
+	if m.peel != nil {
+		if err := m.peel.SetRoute(player.IP, backend); err != nil {
+			fmt.Printf("[Matcher] Failed to set route for %s: %v\n", playerUUID, err)
+		}
 	}
+
+	config := m.config.Load()
+	m.referrals.Add(serverID, referrals.Referral{
+		PlayerUUID: playerUUID,
+		Host:       config.RelayHost,
+		Port:       config.RelayPort,
+	})
 }
 
 // updatePeelRoute updates the Peel route for a player
@@ -190,32 +554,35 @@ func (m *Matcher) updatePeelRoute(playerUUID string, backend string) {
 	}
 }
 
-// findReadyMatch queries registry for a ready match
-func (m *Matcher) findReadyMatch(mode string) (registry.ServerInfo, string, bool) {
-	url := fmt.Sprintf("%s/registry/servers?type=game&mode=%s&hasReadyMatch=true", m.config.RegistryURL, mode)
-
-	resp, err := m.client.Get(url)
-	if err != nil {
-		fmt.Printf("[Matcher] Registry error: %v\n", err)
-		return registry.ServerInfo{}, "", false
-	}
-	defer resp.Body.Close()
-
-	var servers []registry.ServerInfo
-	if err := json.NewDecoder(resp.Body).Decode(&servers); err != nil {
-		return registry.ServerInfo{}, "", false
-	}
+// findReadyMatches looks up every ready match in a mode,
+// ordered by server and match ID
+func (m *Matcher) findReadyMatches(mode string) []ReadyMatch {
+	servers := m.servers.List(registry.ListFilter{
+		Type:          registry.TypeGame,
+		Mode:          mode,
+		HasReadyMatch: true,
+	})
 
-	// Find first server with a ready match
+	var ready []ReadyMatch
 	for _, server := range servers {
 		for matchID, match := range server.Matches {
-			if match.Status == "ready" {
-				return server, matchID, true
+			if match.Status == "ready" && !m.coolingDown(server.ID, matchID) {
+				ready = append(ready, ReadyMatch{
+					Server:  server,
+					MatchID: matchID,
+					Need:    match.Need,
+				})
 			}
 		}
 	}
 
-	return registry.ServerInfo{}, "", false
+	sort.Slice(ready, func(i, j int) bool {
+		if ready[i].Server.ID != ready[j].Server.ID {
+			return ready[i].Server.ID < ready[j].Server.ID
+		}
+		return ready[i].MatchID < ready[j].MatchID
+	})
+	return ready
 }
 
 func (m *Matcher) queueReferral(playerUUID string, backend string) {
@@ -233,8 +600,9 @@ func (m *Matcher) queueReferral(playerUUID string, backend string) {
 	}
 
 	// Determine referral target
-	host := m.config.RelayHost
-	port := m.config.RelayPort
+	config := m.config.Load()
+	host := config.RelayHost
+	port := config.RelayPort
 
 	// Queue referral for origin server to poll
 	m.referrals.Add(player.ServerID, referrals.Referral{
@@ -247,34 +615,42 @@ func (m *Matcher) queueReferral(playerUUID string, backend string) {
 }
 
 // sendExpect tells game server to expect players
-func (m *Matcher) sendExpect(server registry.ServerInfo, matchID string, uuids []string) {
+func (m *Matcher) sendExpect(server registry.ServerInfo, matchID string, uuids []string, teams [][]string) error {
 	url := fmt.Sprintf("http://%s:%d/expect", server.Host, server.WebhookPort)
 
 	req := ExpectRequest{
 		MatchID: matchID,
 		UUIDs:   uuids,
+		Teams:   teams,
 	}
 
 	body, _ := json.Marshal(req)
 	resp, err := m.client.Post(url, "application/json", bytes.NewReader(body))
 	if err != nil {
-		fmt.Printf("[Matcher] Failed to send expect to %s: %v\n", server.ID, err)
-		return
+		return fmt.Errorf("failed to send expect to %s: %w", server.ID, err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("expect to %s returned %d", server.ID, resp.StatusCode)
+	}
+
 	fmt.Printf("[Matcher] Sent expect to %s for match %s\n", server.ID, matchID)
+	return nil
 }
 
 // updateMatchStatus updates match in registry
-func (m *Matcher) updateMatchStatus(serverID string, matchID string, status registry.MatchStatus, players []string) {
-	url := fmt.Sprintf("%s/registry/servers/%s/matches/%s", m.config.RegistryURL, serverID, matchID)
-
-	match := registry.MatchInfo{
+func (m *Matcher) updateMatchStatus(serverID string, matchID string, status registry.MatchStatus, players []string) error {
+	return m.putMatch(serverID, matchID, registry.MatchInfo{
 		Status:  status,
 		Need:    len(players),
 		Players: players,
-	}
+	})
+}
+
+// putMatch replaces a match in the registry
+func (m *Matcher) putMatch(serverID string, matchID string, match registry.MatchInfo) error {
+	url := fmt.Sprintf("%s/registry/servers/%s/matches/%s", m.config.Load().RegistryURL, serverID, matchID)
 
 	body, _ := json.Marshal(match)
 	req, _ := http.NewRequest(http.MethodPut, url, bytes.NewReader(body))
@@ -282,26 +658,50 @@ func (m *Matcher) updateMatchStatus(serverID string, matchID string, status regi
 
 	resp, err := m.client.Do(req)
 	if err != nil {
-		fmt.Printf("[Matcher] Failed to update match status: %v\n", err)
-		return
+		return fmt.Errorf("failed to update match status: %w", err)
 	}
 	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("match status update returned %d", resp.StatusCode)
+	}
+
+	m.servers.SetMatch(serverID, matchID, match)
+	return nil
 }
 
-// FindLobby finds a lobby with capacity
-func (m *Matcher) FindLobby() (registry.ServerInfo, bool) {
-	url := fmt.Sprintf("%s/registry/servers?type=lobby&hasCapacity=true", m.config.RegistryURL)
+// GetServer looks up a single server, falling back to the registry if the
+// view hasn't seen it yet
+func (m *Matcher) GetServer(id string) (registry.ServerInfo, error) {
+	if server, ok := m.servers.Get(id); ok {
+		return server, nil
+	}
+
+	url := fmt.Sprintf("%s/registry/servers/%s", m.config.Load().RegistryURL, id)
 
 	resp, err := m.client.Get(url)
 	if err != nil {
-		return registry.ServerInfo{}, false
+		return registry.ServerInfo{}, err
 	}
 	defer resp.Body.Close()
 
-	var servers []registry.ServerInfo
-	if err := json.NewDecoder(resp.Body).Decode(&servers); err != nil {
-		return registry.ServerInfo{}, false
+	if resp.StatusCode != http.StatusOK {
+		return registry.ServerInfo{}, fmt.Errorf("registry returned %d", resp.StatusCode)
+	}
+
+	var server registry.ServerInfo
+	if err := json.NewDecoder(resp.Body).Decode(&server); err != nil {
+		return registry.ServerInfo{}, err
 	}
+	return server, nil
+}
+
+// FindLobby finds a lobby with capacity
+func (m *Matcher) FindLobby() (registry.ServerInfo, bool) {
+	servers := m.servers.List(registry.ListFilter{
+		Type:        registry.TypeLobby,
+		HasCapacity: true,
+	})
 
 	if len(servers) > 0 {
 		return servers[0], true
@@ -0,0 +1,89 @@
+package matcher
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/bananalabs-oss/bananasplit/internal/penalties"
+	"github.com/bananalabs-oss/bananasplit/internal/queue"
+)
+
+// NoShowAction decides what happens to players who never reach their game server
+type NoShowAction string
+
+const (
+	NoShowRequeue NoShowAction = "requeue" // put them back at the front of the queue, unless their penalty banned them
+	NoShowLobby   NoShowAction = "lobby"   // leave them in the lobby, out of the queue
+)
+
+// checkArrivals cancels matches whose players haven't all arrived within
+// the arrival timeout. Players who did arrive are sent back to a lobby and
+// requeued at the front, unless they backfilled a running match; missing
+// players are penalized and handled by NoShowAction. Requeued players keep
+// the entry they were matched from, so parties that all arrived, or all
+// went missing, stay together.
+//
+// Requeues go through the queue's guard, so a missing player whose penalty
+// came with a ban is treated as with NoShowLobby instead.
+func (m *Matcher) checkArrivals() {
+	for _, overdue := range m.matches.Overdue(m.config.Load().ArrivalTimeout) {
+		missing := overdue.Missing()
+
+		match, err := m.cancel(overdue.ID)
+		if err != nil {
+			continue
+		}
+
+		fmt.Printf("[Matcher] Match %s: %d of %d players never arrived\n", match.ID, len(missing), len(match.Players))
+
+		// Players who made it did nothing wrong, so they go first. Backfill
+		// players who made it stay in the running match.
+		var requeue []queue.QueueEntry
+		if !match.Backfill {
+			lobbies := make(map[string]string)
+			for _, uuid := range match.Arrived {
+				lobbyID, ok := m.sendHome(match, uuid)
+				if !ok {
+					lobbyID = match.Lobbies[uuid]
+				}
+				lobbies[uuid] = lobbyID
+			}
+			for _, entry := range match.Regroup(match.Arrived) {
+				entry.LobbyServer = lobbies[entry.UUID]
+				requeue = append(requeue, entry)
+			}
+		}
+
+		var noShows []string
+		for _, uuid := range missing {
+			m.penalties.Record(uuid, penalties.ReasonNoShow)
+			if m.config.Load().NoShowAction == NoShowLobby {
+				m.sendHome(match, uuid)
+				continue
+			}
+			noShows = append(noShows, uuid)
+		}
+		requeue = append(requeue, match.Regroup(noShows)...)
+
+		// Parties go back together, with their rating and modes, but wait
+		// afresh. Missing players were just penalized, so they go back at
+		// low priority.
+		for i := range requeue {
+			requeue[i].Priority = m.RequeuePriority(requeue[i])
+			requeue[i].JoinedAt = time.Time{}
+			requeue[i].Rejoined = false
+		}
+
+		if len(requeue) > 0 {
+			// Players who arrived were already sent home
+			for _, entry := range m.queues.Requeue(match.Mode, requeue...) {
+				for _, uuid := range entry.Players() {
+					if slices.Contains(noShows, uuid) {
+						m.sendHome(match, uuid)
+					}
+				}
+			}
+		}
+	}
+}
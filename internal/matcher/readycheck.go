@@ -0,0 +1,185 @@
+package matcher
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bananalabs-oss/bananasplit/internal/matches"
+	"github.com/bananalabs-oss/bananasplit/internal/penalties"
+	"github.com/bananalabs-oss/bananasplit/internal/queue"
+	"github.com/bananalabs-oss/potassium/registry"
+)
+
+// ErrNoReadyCheck is returned when a player has no pending ready check
+var ErrNoReadyCheck = errors.New("no pending ready check")
+
+// AcceptRequest is sent to lobby servers to prompt players to accept a match
+type AcceptRequest struct {
+	MatchID  string    `json:"matchId"`
+	Mode     string    `json:"mode"`
+	Players  []string  `json:"players"`
+	Deadline time.Time `json:"deadline"`
+}
+
+// readyCheck is a match waiting for every player to accept
+type readyCheck struct {
+	record     matches.Match
+	assignment Assignment
+	deadline   time.Time
+	accepted   map[string]bool
+	declined   map[string]penalties.Reason
+}
+
+// done reports whether every player accepted
+func (c *readyCheck) done() bool {
+	return len(c.accepted) == len(c.record.Players)
+}
+
+// failed reports whether anyone declined or the deadline passed
+func (c *readyCheck) failed(now time.Time) bool {
+	return len(c.declined) > 0 || now.After(c.deadline)
+}
+
+// startReadyCheck reserves the match and asks every player to accept it
+func (m *Matcher) startReadyCheck(record matches.Match, assignment Assignment, timeout time.Duration) {
+	server := assignment.Match.Server
+	matchID := assignment.Match.MatchID
+
+	// Take the match out of the ready pool while players decide
+	if err := m.updateMatchStatus(server.ID, matchID, registry.StatusStarting, record.Players); err != nil {
+		m.rollback(record, assignment.Entries, false, err)
+		return
+	}
+	m.matches.Transition(record.ID, matches.StateAccepting)
+
+	check := &readyCheck{
+		record:     record,
+		assignment: assignment,
+		deadline:   time.Now().Add(timeout),
+		accepted:   make(map[string]bool),
+		declined:   make(map[string]penalties.Reason),
+	}
+
+	m.checksMu.Lock()
+	m.checks[record.ID] = check
+	m.checksMu.Unlock()
+
+	m.postToLobbies(assignment.Entries, "/match-accept", func(uuids []string) interface{} {
+		return AcceptRequest{
+			MatchID:  record.ID,
+			Mode:     record.Mode,
+			Players:  uuids,
+			Deadline: check.deadline,
+		}
+	})
+}
+
+// Accept records a player accepting their pending ready check
+func (m *Matcher) Accept(uuid string) (string, error) {
+	return m.respond(uuid, "")
+}
+
+// Decline records a player declining their pending ready check
+func (m *Matcher) Decline(uuid string) (string, error) {
+	return m.respond(uuid, penalties.ReasonDecline)
+}
+
+// Dodge records a player leaving the queue during their ready check
+func (m *Matcher) Dodge(uuid string) (string, error) {
+	return m.respond(uuid, penalties.ReasonDodge)
+}
+
+// respond records a ready check answer, returning the match record ID. An
+// empty reason accepts; anything else declines for that reason.
+func (m *Matcher) respond(uuid string, reason penalties.Reason) (string, error) {
+	m.checksMu.Lock()
+	defer m.checksMu.Unlock()
+
+	for id, check := range m.checks {
+		if _, ok := check.record.Lobbies[uuid]; !ok {
+			continue
+		}
+		if reason == "" {
+			check.accepted[uuid] = true
+		} else {
+			check.declined[uuid] = reason
+		}
+		return id, nil
+	}
+	return "", ErrNoReadyCheck
+}
+
+// dropReadyCheck removes a match's pending ready check, returning it, or
+// nil if the match has none
+func (m *Matcher) dropReadyCheck(id string) *readyCheck {
+	m.checksMu.Lock()
+	defer m.checksMu.Unlock()
+
+	check := m.checks[id]
+	delete(m.checks, id)
+	return check
+}
+
+// checkReadyChecks commits matches everyone accepted and fails those with a
+// decline or past their deadline
+func (m *Matcher) checkReadyChecks() {
+	now := time.Now()
+
+	var finished []*readyCheck
+	m.checksMu.Lock()
+	for id, check := range m.checks {
+		if check.done() || check.failed(now) {
+			finished = append(finished, check)
+			delete(m.checks, id)
+		}
+	}
+	m.checksMu.Unlock()
+
+	for _, check := range finished {
+		if check.done() && len(check.declined) == 0 {
+			fmt.Printf("[Matcher] Match %s accepted by all %d players\n", check.record.ID, len(check.record.Players))
+			m.commit(check.record, check.assignment, true)
+		} else {
+			m.failReadyCheck(check)
+		}
+	}
+}
+
+// failReadyCheck cancels the match and returns entries whose players all
+// accepted to the front of the queue. Entries with a decline or no answer
+// lose their place, and the players who declined, dodged or never answered
+// are penalized. Players still deciding when someone else declined are
+// treated as having accepted.
+func (m *Matcher) failReadyCheck(check *readyCheck) {
+	expired := time.Now().After(check.deadline)
+
+	var kept []queue.QueueEntry
+	var dropped []string
+	for _, entry := range check.assignment.Entries {
+		accepted := true
+		for _, uuid := range entry.Players() {
+			if reason, ok := check.declined[uuid]; ok {
+				m.penalties.Record(uuid, reason)
+			} else if !check.accepted[uuid] && expired {
+				m.penalties.Record(uuid, penalties.ReasonDecline)
+			} else {
+				continue
+			}
+			accepted = false
+			dropped = append(dropped, uuid)
+		}
+		if accepted {
+			entry.Priority = m.RequeuePriority(entry)
+			kept = append(kept, entry)
+		}
+	}
+
+	m.matches.Transition(check.record.ID, matches.StateCancelled)
+	m.release(check.record)
+	if len(kept) > 0 {
+		m.queues.PushFront(check.record.Mode, kept...)
+	}
+
+	fmt.Printf("[Matcher] Ready check for match %s failed, %d entries requeued, dropped %v\n", check.record.ID, len(kept), dropped)
+}
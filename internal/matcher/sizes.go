@@ -0,0 +1,45 @@
+package matcher
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SizeConfig lets a mode start matches with a range of player counts
+type SizeConfig struct {
+	Min        int           // Fewest players a match may start with once relaxed
+	Ideal      int           // Players needed to start a match straight away, 0 = Max
+	Max        int           // Most players sent to one match, 0 = whatever the game server asks for
+	RelaxAfter time.Duration // How long the oldest entry waits before matches may start with Min
+}
+
+// Validate checks that 1 <= Min <= Ideal <= Max, ignoring unset values.
+// With a team layout, Min must also put a player on every team.
+func (s SizeConfig) Validate(teams TeamLayout) error {
+	if s.Min < 1 || (s.Ideal > 0 && s.Ideal < s.Min) || (s.Max > 0 && s.Max < max(s.Min, s.Ideal)) || s.RelaxAfter < 0 {
+		return errors.New("invalid sizes, expected 1 <= min <= ideal <= max")
+	}
+	if s.Min < len(teams) {
+		return fmt.Errorf("invalid sizes, a match of %d leaves some %s teams empty", s.Min, teams)
+	}
+	return nil
+}
+
+// Range returns the fewest and most players to send to a match that asks
+// for need players, once the oldest entry has waited for waited
+func (s SizeConfig) Range(need int, waited time.Duration) (int, int) {
+	hi := need
+	if s.Max > 0 && s.Max < hi {
+		hi = s.Max
+	}
+
+	lo := hi
+	if s.Ideal > 0 {
+		lo = s.Ideal
+	}
+	if s.Min > 0 && waited >= s.RelaxAfter {
+		lo = s.Min
+	}
+	return min(lo, hi), hi
+}
@@ -0,0 +1,122 @@
+package matcher
+
+import (
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/bananalabs-oss/bananasplit/internal/queue"
+)
+
+// SkillConfig controls rating-based matching for a mode
+type SkillConfig struct {
+	BaseWindow float64 // Allowed rating spread when the oldest entry has just joined
+	Growth     float64 // Window growth per second the oldest entry has waited
+	MaxWindow  float64 // Upper bound on the window, 0 = unbounded
+}
+
+// Window returns the allowed rating spread after waiting for wait
+func (s SkillConfig) Window(wait time.Duration) float64 {
+	window := s.BaseWindow + s.Growth*wait.Seconds()
+	if s.MaxWindow > 0 && window > s.MaxWindow {
+		window = s.MaxWindow
+	}
+	return window
+}
+
+// maxSpanTries caps how many rating spans a skill selector tries to fill.
+// A span only fails when its parties can't be packed into the teams.
+const maxSpanTries = 8
+
+// span is a run of entries in rating order whose ratings fit in the window
+type span struct {
+	lo, hi int // positions in rating order, hi exclusive
+	oldest int // index of the longest-waiting entry in the span
+}
+
+// selectWithinWindow returns a Selector that takes entries filling teams of
+// the given sizes whose ratings all fall within the skill window. The window
+// is sized by how long the oldest entry has waited. Spans holding the
+// longest-waiting players are tried first, and each is filled in FIFO
+// order, so the longest-waiting players are matched first.
+func selectWithinWindow(sizes []int, skill SkillConfig, now time.Time) queue.Selector {
+	need := 0
+	for _, size := range sizes {
+		need += size
+	}
+
+	return func(entries []queue.QueueEntry) []int {
+		if len(entries) == 0 || need <= 0 {
+			return nil
+		}
+
+		window := skill.Window(now.Sub(oldest(entries)))
+
+		// Entries in rating order, FIFO order among equal ratings
+		byRating := make([]int, len(entries))
+		for i := range byRating {
+			byRating[i] = i
+		}
+		sort.SliceStable(byRating, func(a, b int) bool {
+			return entries[byRating[a]].Rating < entries[byRating[b]].Rating
+		})
+
+		// Slide the window up the ratings, keeping every span with enough
+		// players. oldestIn holds positions whose entries joined earlier
+		// than every later position in the span, so its head is the
+		// longest-waiting entry in the span.
+		var spans []span
+		var oldestIn []int
+		players, hi := 0, 0
+		for lo := range byRating {
+			for hi < len(byRating) && (hi == lo || entries[byRating[hi]].Rating-entries[byRating[lo]].Rating <= window) {
+				for len(oldestIn) > 0 && byRating[oldestIn[len(oldestIn)-1]] > byRating[hi] {
+					oldestIn = oldestIn[:len(oldestIn)-1]
+				}
+				oldestIn = append(oldestIn, hi)
+				players += entries[byRating[hi]].Size()
+				hi++
+			}
+
+			if players >= need {
+				spans = append(spans, span{lo: lo, hi: hi, oldest: byRating[oldestIn[0]]})
+			}
+
+			players -= entries[byRating[lo]].Size()
+			if oldestIn[0] == lo {
+				oldestIn = oldestIn[1:]
+			}
+		}
+
+		sort.SliceStable(spans, func(a, b int) bool {
+			return spans[a].oldest < spans[b].oldest
+		})
+		for i, s := range spans {
+			if i == maxSpanTries {
+				break
+			}
+			if picked := fillSpan(entries, byRating[s.lo:s.hi], sizes); picked != nil {
+				return picked
+			}
+		}
+		return nil
+	}
+}
+
+// fillSpan fills the teams from the given entries in FIFO order, returning
+// indices into entries
+func fillSpan(entries []queue.QueueEntry, members []int, sizes []int) []int {
+	members = slices.Clone(members)
+	slices.Sort(members)
+
+	candidates := make([]queue.QueueEntry, len(members))
+	for i, index := range members {
+		candidates[i] = entries[index]
+	}
+
+	picked := fillTeams(sizes)(candidates)
+	for i, index := range picked {
+		picked[i] = members[index]
+	}
+	return picked
+}
@@ -0,0 +1,116 @@
+package matcher
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bananalabs-oss/bananasplit/internal/queue"
+)
+
+func rated(ratings ...float64) []queue.QueueEntry {
+	entries := make([]queue.QueueEntry, len(ratings))
+	for i, rating := range ratings {
+		entries[i] = queue.QueueEntry{UUID: fmt.Sprintf("p%d", i), Rating: rating}
+	}
+	return entries
+}
+
+func TestSelectWithinWindow(t *testing.T) {
+	now := time.Now()
+	narrow := SkillConfig{BaseWindow: 100}
+
+	tests := []struct {
+		name    string
+		entries []queue.QueueEntry
+		sizes   []int
+		skill   SkillConfig
+		want    []int
+	}{
+		{
+			name:    "oldest player anchors the group",
+			entries: rated(1000, 2000, 1050, 2010, 1100),
+			sizes:   []int{3},
+			skill:   narrow,
+			want:    []int{0, 2, 4},
+		},
+		{
+			name:    "passes over the oldest if nobody is close",
+			entries: rated(5000, 1000, 2000, 1050),
+			sizes:   []int{2},
+			skill:   narrow,
+			want:    []int{1, 3},
+		},
+		{
+			name:    "takes the oldest players inside the span",
+			entries: rated(1000, 1010, 1020, 1030),
+			sizes:   []int{2},
+			skill:   narrow,
+			want:    []int{0, 1},
+		},
+		{
+			name:    "nothing when every spread is too wide",
+			entries: rated(1000, 1200, 1400),
+			sizes:   []int{2},
+			skill:   narrow,
+			want:    nil,
+		},
+		{
+			name:    "window grows with the oldest wait",
+			entries: rated(1000, 1200, 1400),
+			sizes:   []int{2},
+			skill:   SkillConfig{BaseWindow: 100, Growth: 10},
+			want:    []int{0, 1},
+		},
+		{
+			name: "parties stay on one team",
+			entries: []queue.QueueEntry{
+				{UUID: "a", Members: []string{"a2", "a3"}, Rating: 1000},
+				{UUID: "b", Members: []string{"b2"}, Rating: 1010},
+				{UUID: "c", Members: []string{"c2"}, Rating: 1020},
+				{UUID: "d", Rating: 1030},
+			},
+			sizes: []int{2, 2},
+			skill: narrow,
+			want:  []int{1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := slices.Clone(tt.entries)
+			for i := range entries {
+				entries[i].JoinedAt = now.Add(-20*time.Second + time.Duration(i)*time.Second)
+			}
+
+			got := selectWithinWindow(tt.sizes, tt.skill, now)(entries)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("picked %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// BenchmarkSkillAssign fills one relaxing match from a busy ranked queue,
+// which tries every size from the ideal down to the minimum
+func BenchmarkSkillAssign(b *testing.B) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	now := time.Now()
+
+	entries := make([]queue.QueueEntry, 5000)
+	for i := range entries {
+		entries[i] = queue.QueueEntry{
+			UUID:     fmt.Sprintf("p%d", i),
+			Rating:   rng.Float64() * 3000,
+			JoinedAt: now.Add(-time.Second),
+		}
+	}
+
+	skill := Skill{Config: SkillConfig{BaseWindow: 1}}
+	match := ReadyMatch{Need: 16, Min: 8}
+	for b.Loop() {
+		skill.Assign("ranked", entries, []ReadyMatch{match})
+	}
+}
@@ -0,0 +1,187 @@
+package matcher
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bananalabs-oss/bananasplit/internal/queue"
+	"github.com/bananalabs-oss/potassium/registry"
+)
+
+// ReadyMatch is a game server match waiting for players
+type ReadyMatch struct {
+	Server   registry.ServerInfo
+	MatchID  string
+	Need     int  // most players to send
+	Min      int  // fewest players the match may start with, 0 = exactly Need
+	Backfill bool // a running match with Need open slots, which may be partly filled
+}
+
+// Assignment places queue entries into a ready match
+type Assignment struct {
+	Match   ReadyMatch
+	Entries []queue.QueueEntry
+	Teams   [][]string // player UUIDs per team, nil = formed from the mode's team layout
+}
+
+// Size returns the number of players in the assignment
+func (a Assignment) Size() int {
+	size := 0
+	for _, entry := range a.Entries {
+		size += entry.Size()
+	}
+	return size
+}
+
+// Strategy decides which queued entries go to which ready matches. It gets
+// a mode's entries in queue order and must not assign an entry twice or
+// overfill a match; entries it leaves out stay queued. Backfills come first
+// in matches.
+type Strategy interface {
+	Assign(mode string, entries []queue.QueueEntry, matches []ReadyMatch) []Assignment
+}
+
+// StrategyFactory builds a strategy from a mode's configuration
+type StrategyFactory func(cfg ModeConfig) Strategy
+
+const (
+	StrategyFIFO  = "fifo"
+	StrategySkill = "skill"
+)
+
+var (
+	strategiesMu sync.RWMutex
+	strategies   = map[string]StrategyFactory{
+		StrategyFIFO: func(cfg ModeConfig) Strategy {
+			return FIFO{Teams: cfg.Teams}
+		},
+		StrategySkill: func(cfg ModeConfig) Strategy {
+			if cfg.Skill == nil {
+				return FIFO{Teams: cfg.Teams}
+			}
+			return Skill{Config: *cfg.Skill, Teams: cfg.Teams}
+		},
+	}
+)
+
+// RegisterStrategy makes a strategy available to modes under name
+func RegisterStrategy(name string, factory StrategyFactory) {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+
+	strategies[name] = factory
+}
+
+// Strategies returns the names of all registered strategies
+func Strategies() []string {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewStrategy builds the strategy a mode is configured to use. Modes without
+// a strategy use skill matching if they have a skill window, otherwise FIFO.
+func NewStrategy(cfg ModeConfig) (Strategy, error) {
+	name := cfg.Strategy
+	if name == "" {
+		name = StrategyFIFO
+		if cfg.Skill != nil {
+			name = StrategySkill
+		}
+	}
+
+	strategiesMu.RLock()
+	factory, ok := strategies[name]
+	strategiesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q", name)
+	}
+	return factory(cfg), nil
+}
+
+// FIFO fills matches with the longest-waiting entries, never splitting parties
+// across teams
+type FIFO struct {
+	Teams TeamLayout
+}
+
+// Assign implements Strategy
+func (f FIFO) Assign(mode string, entries []queue.QueueEntry, matches []ReadyMatch) []Assignment {
+	return assignEach(entries, matches, func(n int) queue.Selector {
+		if f.Teams == nil {
+			return queue.Fill(n)
+		}
+		return fillTeams(f.Teams.Split(n))
+	})
+}
+
+// Skill fills matches with entries whose ratings fall inside a window that
+// widens the longer the oldest entry has waited
+type Skill struct {
+	Config SkillConfig
+	Teams  TeamLayout
+}
+
+// Assign implements Strategy
+func (s Skill) Assign(mode string, entries []queue.QueueEntry, matches []ReadyMatch) []Assignment {
+	now := time.Now()
+	return assignEach(entries, matches, func(n int) queue.Selector {
+		return selectWithinWindow(s.Teams.Split(n), s.Config, now)
+	})
+}
+
+// assignEach fills each match in turn from the entries not yet assigned,
+// using the selector built for the match's size. Matches with a size range
+// take the largest size the selector can fill. Backfills take whoever fits,
+// longest-waiting first.
+func assignEach(entries []queue.QueueEntry, matches []ReadyMatch, selector func(n int) queue.Selector) []Assignment {
+	var assignments []Assignment
+	remaining := entries
+
+	for _, match := range matches {
+		var picked []int
+		if match.Backfill {
+			picked = fillOpenSlots(match.Need)(remaining)
+		} else {
+			fewest := match.Need
+			if match.Min > 0 {
+				fewest = match.Min
+			}
+			for n := match.Need; n >= max(fewest, 1) && len(picked) == 0; n-- {
+				picked = selector(n)(remaining)
+			}
+		}
+		if len(picked) == 0 {
+			continue
+		}
+
+		taken := make(map[int]bool, len(picked))
+		for _, i := range picked {
+			taken[i] = true
+		}
+
+		assignment := Assignment{Match: match}
+		kept := make([]queue.QueueEntry, 0, len(remaining)-len(picked))
+		for i, entry := range remaining {
+			if taken[i] {
+				assignment.Entries = append(assignment.Entries, entry)
+			} else {
+				kept = append(kept, entry)
+			}
+		}
+
+		assignments = append(assignments, assignment)
+		remaining = kept
+	}
+
+	return assignments
+}
@@ -0,0 +1,187 @@
+package matcher
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bananalabs-oss/bananasplit/internal/queue"
+)
+
+// TeamLayout is the number of players on each team, e.g. 4x4 is [4, 4]
+type TeamLayout []int
+
+// ParseTeamLayout parses a layout such as "4x4" or "2x2x2x2"
+func ParseTeamLayout(s string) (TeamLayout, error) {
+	parts := strings.Split(s, "x")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid team layout %q, expected at least two teams like 4x4", s)
+	}
+
+	layout := make(TeamLayout, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid team size %q in layout %q", part, s)
+		}
+		layout[i] = n
+	}
+	return layout, nil
+}
+
+func (l TeamLayout) String() string {
+	parts := make([]string, len(l))
+	for i, n := range l {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, "x")
+}
+
+// Total returns the number of players the layout holds
+func (l TeamLayout) Total() int {
+	total := 0
+	for _, n := range l {
+		total += n
+	}
+	return total
+}
+
+// Largest returns the size of the biggest team
+func (l TeamLayout) Largest() int {
+	largest := 0
+	for _, n := range l {
+		largest = max(largest, n)
+	}
+	return largest
+}
+
+// Split sizes the teams for a match of n players, keeping the layout's
+// proportions. Without a layout the whole match is one team.
+func (l TeamLayout) Split(n int) []int {
+	total := l.Total()
+	if total == 0 {
+		return []int{n}
+	}
+
+	sizes := make([]int, len(l))
+	assigned := 0
+	for i, size := range l {
+		sizes[i] = size * n / total
+		assigned += sizes[i]
+	}
+
+	// Hand out what integer division left over, one player per team
+	for i := 0; assigned < n; i = (i + 1) % len(sizes) {
+		sizes[i]++
+		assigned++
+	}
+	return sizes
+}
+
+// fit returns the team with the most free slots that can take size more
+// players, or -1 if none can
+func fit(rooms []int, size int) int {
+	best := -1
+	for i, room := range rooms {
+		if room >= size && (best < 0 || room > rooms[best]) {
+			best = i
+		}
+	}
+	return best
+}
+
+// fillTeams returns a Selector that takes entries in FIFO order, placing
+// each on a team with room for the whole party, until every team is full
+func fillTeams(sizes []int) queue.Selector {
+	return func(entries []queue.QueueEntry) []int {
+		rooms := append([]int(nil), sizes...)
+		remaining := 0
+		for _, room := range rooms {
+			remaining += room
+		}
+		if remaining <= 0 {
+			return nil
+		}
+
+		var picked []int
+		for i, entry := range entries {
+			team := fit(rooms, entry.Size())
+			if team < 0 {
+				continue
+			}
+
+			picked = append(picked, i)
+			rooms[team] -= entry.Size()
+			remaining -= entry.Size()
+			if remaining == 0 {
+				return picked
+			}
+		}
+		return nil
+	}
+}
+
+// formTeams splits entries into teams of the given sizes, keeping parties
+// together. Parties are placed largest first, each on the team with the
+// lowest total rating that has room, which balances teams when entries
+// carry ratings. If that packing fails, entries are placed in queue order
+// instead. Returns nil if the entries can't fill the teams exactly.
+func formTeams(entries []queue.QueueEntry, sizes []int) [][]string {
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		ea, eb := entries[order[a]], entries[order[b]]
+		if ea.Size() != eb.Size() {
+			return ea.Size() > eb.Size()
+		}
+		return ea.Rating > eb.Rating
+	})
+
+	if teams := packTeams(entries, order, sizes, true); teams != nil {
+		return teams
+	}
+
+	for i := range order {
+		order[i] = i
+	}
+	return packTeams(entries, order, sizes, false)
+}
+
+// packTeams places entries on teams in the given order. With balance set,
+// each entry goes to the team with the lowest total rating that has room;
+// otherwise to the team with the most room.
+func packTeams(entries []queue.QueueEntry, order []int, sizes []int, balance bool) [][]string {
+	rooms := append([]int(nil), sizes...)
+	ratings := make([]float64, len(sizes))
+	teams := make([][]string, len(sizes))
+
+	for _, i := range order {
+		entry := entries[i]
+
+		team := fit(rooms, entry.Size())
+		if team < 0 {
+			return nil
+		}
+		if balance {
+			for t, room := range rooms {
+				if room >= entry.Size() && ratings[t] < ratings[team] {
+					team = t
+				}
+			}
+		}
+
+		teams[team] = append(teams[team], entry.Players()...)
+		rooms[team] -= entry.Size()
+		ratings[team] += entry.Rating * float64(entry.Size())
+	}
+
+	for _, room := range rooms {
+		if room != 0 {
+			return nil
+		}
+	}
+	return teams
+}
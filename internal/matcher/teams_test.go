@@ -0,0 +1,162 @@
+package matcher
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/bananalabs-oss/bananasplit/internal/queue"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		layout TeamLayout
+		n      int
+		want   []int
+	}{
+		{nil, 5, []int{5}},
+		{TeamLayout{4, 4}, 8, []int{4, 4}},
+		{TeamLayout{4, 4}, 7, []int{4, 3}},
+		{TeamLayout{2, 2, 2, 2}, 6, []int{2, 2, 1, 1}},
+		{TeamLayout{2, 2, 2, 2}, 4, []int{1, 1, 1, 1}},
+		{TeamLayout{3, 1}, 8, []int{6, 2}},
+		{TeamLayout{3, 1}, 5, []int{4, 1}},
+	}
+
+	for _, tt := range tests {
+		got := tt.layout.Split(tt.n)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%v.Split(%d) = %v, want %v", tt.layout, tt.n, got, tt.want)
+		}
+		if sum(got) != tt.n {
+			t.Errorf("%v.Split(%d) holds %d players", tt.layout, tt.n, sum(got))
+		}
+	}
+}
+
+func TestFillTeams(t *testing.T) {
+	tests := []struct {
+		name    string
+		sizes   []int
+		entries []queue.QueueEntry
+		want    []int
+	}{
+		{
+			name:    "queue order",
+			sizes:   []int{2, 2},
+			entries: solos("a", "b", "c", "d", "e"),
+			want:    []int{0, 1, 2, 3},
+		},
+		{
+			name:  "party too big for any team keeps its place",
+			sizes: []int{2, 2},
+			entries: []queue.QueueEntry{
+				{UUID: "a"},
+				{UUID: "b", Members: []string{"b2", "b3"}},
+				{UUID: "c", Members: []string{"c2"}},
+				{UUID: "d"},
+			},
+			want: []int{0, 2, 3},
+		},
+		{
+			name:    "nothing if the teams can't be filled",
+			sizes:   []int{2, 2},
+			entries: []queue.QueueEntry{{UUID: "a", Members: []string{"a2"}}, {UUID: "b", Members: []string{"b2", "b3"}}},
+			want:    nil,
+		},
+		{
+			name:    "nothing for empty teams",
+			sizes:   []int{0, 0},
+			entries: solos("a"),
+			want:    nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fillTeams(tt.sizes)(tt.entries)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("picked %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormTeams(t *testing.T) {
+	tests := []struct {
+		name    string
+		sizes   []int
+		entries []queue.QueueEntry
+		want    [][]string
+	}{
+		{
+			name:    "parties stay together",
+			sizes:   []int{2, 2},
+			entries: []queue.QueueEntry{{UUID: "a"}, {UUID: "p", Members: []string{"p2"}}, {UUID: "b"}},
+			want:    [][]string{{"p", "p2"}, {"a", "b"}},
+		},
+		{
+			name:  "ratings are balanced",
+			sizes: []int{2, 2},
+			entries: []queue.QueueEntry{
+				{UUID: "r100", Rating: 100},
+				{UUID: "r1000", Rating: 1000},
+				{UUID: "r200", Rating: 200},
+				{UUID: "r900", Rating: 900},
+			},
+			want: [][]string{{"r1000", "r100"}, {"r900", "r200"}},
+		},
+		{
+			// Balancing puts B and X together, leaving no team with room
+			// for Z, so the teams are packed in queue order instead
+			name:  "queue order when balancing can't pack the parties",
+			sizes: []int{6, 6},
+			entries: []queue.QueueEntry{
+				{UUID: "a", Members: []string{"a2", "a3"}, Rating: 100},
+				{UUID: "x", Members: []string{"x2"}, Rating: 50},
+				{UUID: "y", Members: []string{"y2"}, Rating: 50},
+				{UUID: "b", Members: []string{"b2", "b3"}, Rating: 10},
+				{UUID: "z", Members: []string{"z2"}, Rating: 50},
+			},
+			want: [][]string{{"a", "a2", "a3", "b", "b2", "b3"}, {"x", "x2", "y", "y2", "z", "z2"}},
+		},
+		{
+			name:    "nil if the entries don't fill the teams exactly",
+			sizes:   []int{2, 2},
+			entries: solos("a", "b", "c"),
+			want:    nil,
+		},
+		{
+			name:    "nil if a party fits on no team",
+			sizes:   []int{2, 2},
+			entries: []queue.QueueEntry{{UUID: "p", Members: []string{"p2", "p3"}}, {UUID: "a"}},
+			want:    nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formTeams(tt.entries, tt.sizes)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("formed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// solos returns one solo entry per UUID
+func solos(uuids ...string) []queue.QueueEntry {
+	entries := make([]queue.QueueEntry, len(uuids))
+	for i, uuid := range uuids {
+		entries[i] = queue.QueueEntry{UUID: uuid}
+	}
+	return entries
+}
+
+func sum(sizes []int) int {
+	total := 0
+	for _, size := range sizes {
+		total += size
+	}
+	return total
+}
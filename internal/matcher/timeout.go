@@ -0,0 +1,105 @@
+package matcher
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bananalabs-oss/bananasplit/internal/queue"
+)
+
+// TimeoutAction decides what happens to players whose queue entry timed out
+type TimeoutAction string
+
+const (
+	TimeoutNotify TimeoutAction = "notify" // only tell their lobby
+	TimeoutRejoin TimeoutAction = "rejoin" // queue them again for the same modes, once
+	TimeoutSwitch TimeoutAction = "switch" // queue them for the suggested mode, once
+)
+
+// QueueExpiredRequest is sent to lobby servers when queued players time out
+type QueueExpiredRequest struct {
+	Players       []string `json:"players"`
+	Modes         []string `json:"modes"`                   // every mode the entry left
+	Waited        float64  `json:"waited"`                  // seconds
+	SuggestedMode string   `json:"suggestedMode,omitempty"` // mode with the shortest estimated wait
+	Rejoined      []string `json:"rejoined,omitempty"`      // modes the players were queued for again
+}
+
+// QueueExpired is the queue's timeout hook. It queues the players again if
+// TimeoutAction says so, then tells their lobby.
+func (m *Matcher) QueueExpired(entry queue.QueueEntry, modes []string) {
+	waited := time.Since(entry.JoinedAt)
+	suggested := m.suggestMode(modes, entry.Size())
+
+	// Entries only get one automatic retry, or players who left would be
+	// queued forever
+	var rejoin []string
+	if !entry.Rejoined {
+		switch m.config.Load().TimeoutAction {
+		case TimeoutRejoin:
+			rejoin = modes
+		case TimeoutSwitch:
+			if suggested != "" {
+				rejoin = []string{suggested}
+			}
+		}
+	}
+
+	var rejoined []string
+	if len(rejoin) > 0 {
+		retry := entry
+		retry.Modes = nil
+		retry.Rejoined = true
+		ticket, err := m.queues.JoinModes(rejoin, retry)
+		if err != nil {
+			fmt.Printf("[Matcher] Failed to requeue %s after timeout: %v\n", entry.UUID, err)
+		} else {
+			rejoined = ticket.Modes
+			fmt.Printf("[Matcher] Requeued %s for %v after timeout\n", entry.UUID, rejoined)
+		}
+	}
+
+	m.postToLobbies([]queue.QueueEntry{entry}, "/queue-expired", func(uuids []string) interface{} {
+		return QueueExpiredRequest{
+			Players:       uuids,
+			Modes:         modes,
+			Waited:        waited.Seconds(),
+			SuggestedMode: suggested,
+			Rejoined:      rejoined,
+		}
+	})
+}
+
+// suggestMode returns the mode, other than the given ones, that an entry of
+// size players may join and would be matched in soonest going by recent
+// throughput.
+// Returns "" if no other mode has matched anyone lately.
+func (m *Matcher) suggestMode(exclude []string, size int) string {
+	candidates := make(map[string]bool)
+	for mode := range m.config.Load().Modes {
+		candidates[mode] = true
+	}
+	for _, mode := range m.queues.Modes() {
+		candidates[mode] = true
+	}
+	for _, mode := range exclude {
+		delete(candidates, mode)
+	}
+
+	best := ""
+	var bestWait time.Duration
+	for mode := range candidates {
+		if m.queues.CheckMode(mode, size) != nil {
+			continue
+		}
+
+		wait, ok := m.EstimateWait(mode, m.queues.Size(mode)+size)
+		if !ok {
+			continue
+		}
+		if best == "" || wait < bestWait || (wait == bestWait && mode < best) {
+			best, bestWait = mode, wait
+		}
+	}
+	return best
+}
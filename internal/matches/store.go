@@ -0,0 +1,443 @@
+package matches
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bananalabs-oss/bananasplit/internal/queue"
+)
+
+// State is where a match is in its lifecycle
+type State string
+
+const (
+	StateCreated      State = "created"      // players picked from the queue
+	StateAccepting    State = "accepting"    // waiting for players to accept a ready check
+	StateExpecting    State = "expecting"    // game server told to expect players
+	StateTransferring State = "transferring" // lobbies told to transfer players
+	StateInProgress   State = "in-progress"  // every player arrived on the game server
+	StateCompleted    State = "completed"    // game server reported the match finished
+	StateCancelled    State = "cancelled"    // assignment failed or an operator stepped in
+)
+
+var (
+	ErrNotFound          = errors.New("match not found")
+	ErrInvalidTransition = errors.New("invalid match state transition")
+)
+
+// transitions lists the states each state may move to
+var transitions = map[State][]State{
+	StateCreated:      {StateAccepting, StateExpecting, StateCancelled},
+	StateAccepting:    {StateExpecting, StateCancelled},
+	StateExpecting:    {StateTransferring, StateCancelled},
+	StateTransferring: {StateInProgress, StateCompleted, StateCancelled},
+	StateInProgress:   {StateCompleted, StateCancelled},
+}
+
+// Match is a group of players assigned to a game server match
+type Match struct {
+	ID        string            `json:"id"`
+	Mode      string            `json:"mode"`
+	ServerID  string            `json:"serverId"`
+	MatchID   string            `json:"matchId"` // match ID on the game server
+	Need      int               `json:"need"`    // players the game server asked for
+	State     State             `json:"state"`
+	Players   []string          `json:"players"`
+	Teams     [][]string        `json:"teams,omitempty"` // player UUIDs per team
+	Lobbies   map[string]string `json:"lobbies"`         // player UUID → lobby they queued from
+	Arrived   []string          `json:"arrived"`         // players confirmed on the game server
+	Backfill  bool              `json:"backfill"`        // players sent to fill open slots in a running match
+	CreatedAt time.Time         `json:"createdAt"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+
+	TransferredAt *time.Time `json:"transferredAt,omitempty"`
+	EndedAt       *time.Time `json:"endedAt,omitempty"`
+
+	Entries []queue.QueueEntry `json:"entries,omitempty"` // queue entries the players were matched from
+}
+
+// Active reports whether the match has not yet finished
+func (m *Match) Active() bool {
+	return m.State != StateCompleted && m.State != StateCancelled
+}
+
+// Missing returns the players who haven't arrived on the game server
+func (m *Match) Missing() []string {
+	arrived := make(map[string]bool, len(m.Arrived))
+	for _, uuid := range m.Arrived {
+		arrived[uuid] = true
+	}
+
+	var missing []string
+	for _, uuid := range m.Players {
+		if !arrived[uuid] {
+			missing = append(missing, uuid)
+		}
+	}
+	return missing
+}
+
+// Store tracks matches from creation until they finish
+type Store struct {
+	mu        sync.RWMutex
+	matches   map[string]*Match // key = ID
+	active    map[string]string // "server/match" → ID of the active match, "server/match/ID" for its backfills
+	retention time.Duration
+}
+
+// NewStore creates a new match store. Finished matches are kept for
+// retention before being forgotten.
+func NewStore(retention time.Duration) *Store {
+	s := &Store{
+		matches:   make(map[string]*Match),
+		active:    make(map[string]string),
+		retention: retention,
+	}
+
+	go s.cleanupLoop()
+
+	return s
+}
+
+// cleanupLoop forgets finished matches
+func (s *Store) cleanupLoop() {
+	ticker := time.NewTicker(time.Minute)
+	for range ticker.C {
+		s.cleanup()
+	}
+}
+
+// cleanup removes matches that finished more than retention ago
+func (s *Store) cleanup() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, match := range s.matches {
+		if match.EndedAt != nil && now.Sub(*match.EndedAt) > s.retention {
+			delete(s.matches, id)
+		}
+	}
+}
+
+// Create records a new match for the given queue entries, split into teams
+// if the mode has them
+func (s *Store) Create(mode string, serverID string, matchID string, need int, entries []queue.QueueEntry, teams [][]string) Match {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	match := newMatch(mode, serverID, matchID, need, entries)
+	match.Teams = teams
+
+	s.matches[match.ID] = match
+	s.active[activeKey(match)] = match.ID
+	return *match
+}
+
+// CreateBackfill records players sent to fill open slots in a running match.
+// It is tracked alongside the running match and finishes with it.
+func (s *Store) CreateBackfill(mode string, serverID string, matchID string, entries []queue.QueueEntry) Match {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	need := 0
+	for _, entry := range entries {
+		need += entry.Size()
+	}
+
+	match := newMatch(mode, serverID, matchID, need, entries)
+	match.Backfill = true
+
+	s.matches[match.ID] = match
+	s.active[activeKey(match)] = match.ID
+	return *match
+}
+
+func newMatch(mode string, serverID string, matchID string, need int, entries []queue.QueueEntry) *Match {
+	now := time.Now()
+	match := &Match{
+		ID:        newID(),
+		Mode:      mode,
+		ServerID:  serverID,
+		MatchID:   matchID,
+		Need:      need,
+		State:     StateCreated,
+		Lobbies:   make(map[string]string),
+		Arrived:   []string{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	for _, entry := range entries {
+		for _, uuid := range entry.Players() {
+			match.Players = append(match.Players, uuid)
+			match.Lobbies[uuid] = entry.LobbyServer
+		}
+	}
+	match.Entries = append([]queue.QueueEntry(nil), entries...)
+	return match
+}
+
+// Regroup returns the queue entries the given players were matched from,
+// cut down to just those players. Parties stay together, and one that lost
+// its leader is led by its next member. Players without an entry, as in
+// snapshots from older versions, get one of their own. Players not in the
+// match are left out.
+func (m *Match) Regroup(uuids []string) []queue.QueueEntry {
+	wanted := make(map[string]bool, len(uuids))
+	for _, uuid := range uuids {
+		if _, ok := m.Lobbies[uuid]; ok {
+			wanted[uuid] = true
+		}
+	}
+
+	var entries []queue.QueueEntry
+	for _, entry := range m.Entries {
+		var kept []string
+		for _, uuid := range entry.Players() {
+			if wanted[uuid] {
+				kept = append(kept, uuid)
+				delete(wanted, uuid)
+			}
+		}
+		if len(kept) == 0 {
+			continue
+		}
+
+		entry.UUID = kept[0]
+		entry.Members = nil
+		if len(kept) > 1 {
+			entry.Members = kept[1:]
+		}
+		entries = append(entries, entry)
+	}
+
+	for _, uuid := range uuids {
+		if wanted[uuid] {
+			entries = append(entries, queue.QueueEntry{UUID: uuid, LobbyServer: m.Lobbies[uuid]})
+			delete(wanted, uuid)
+		}
+	}
+	return entries
+}
+
+// Transition moves a match to a new state
+func (s *Store) Transition(id string, state State) (Match, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	match, ok := s.matches[id]
+	if !ok {
+		return Match{}, ErrNotFound
+	}
+
+	allowed := false
+	for _, next := range transitions[match.State] {
+		if next == state {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return *match, fmt.Errorf("%w: %s → %s", ErrInvalidTransition, match.State, state)
+	}
+
+	now := time.Now()
+	match.State = state
+	match.UpdatedAt = now
+	if state == StateTransferring {
+		match.TransferredAt = &now
+	}
+	if !match.Active() {
+		s.end(match, now)
+
+		// Backfills finish with the match they joined
+		if !match.Backfill {
+			for _, backfill := range s.backfills(match.ServerID, match.MatchID) {
+				backfill.State = state
+				backfill.UpdatedAt = now
+				s.end(backfill, now)
+			}
+		}
+	}
+	return *match, nil
+}
+
+// end marks a match finished and drops it from the active index. Callers
+// must hold mu.
+func (s *Store) end(match *Match, now time.Time) {
+	match.EndedAt = &now
+	key := activeKey(match)
+	if s.active[key] == match.ID {
+		delete(s.active, key)
+	}
+}
+
+// backfills returns the active backfills of a game server match. Callers
+// must hold mu.
+func (s *Store) backfills(serverID string, matchID string) []*Match {
+	var list []*Match
+	for _, id := range s.active {
+		match := s.matches[id]
+		if match.Backfill && match.ServerID == serverID && match.MatchID == matchID {
+			list = append(list, match)
+		}
+	}
+	return list
+}
+
+// Arrive records that a player reached the game server of their match.
+// Once every player has arrived, a transferring match moves to in-progress.
+func (s *Store) Arrive(serverID string, uuid string) (Match, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var match *Match
+	for _, id := range s.active {
+		candidate := s.matches[id]
+		if _, ok := candidate.Lobbies[uuid]; ok && candidate.ServerID == serverID {
+			match = candidate
+			break
+		}
+	}
+	if match == nil {
+		return Match{}, false
+	}
+
+	for _, arrived := range match.Arrived {
+		if arrived == uuid {
+			return *match, true
+		}
+	}
+
+	match.Arrived = append(match.Arrived, uuid)
+	match.UpdatedAt = time.Now()
+	if match.State == StateTransferring && len(match.Arrived) == len(match.Players) {
+		match.State = StateInProgress
+	}
+	return *match, true
+}
+
+// Overdue returns transferring matches whose players haven't all arrived
+// within timeout
+func (s *Store) Overdue(timeout time.Duration) []Match {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	var overdue []Match
+	for _, id := range s.active {
+		match := s.matches[id]
+		if match.State == StateTransferring && match.TransferredAt != nil && now.Sub(*match.TransferredAt) > timeout {
+			overdue = append(overdue, *match)
+		}
+	}
+	return overdue
+}
+
+// Get returns a match by ID
+func (s *Store) Get(id string) (Match, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	match, ok := s.matches[id]
+	if !ok {
+		return Match{}, false
+	}
+	return *match, true
+}
+
+// FindActive returns the unfinished match running on a game server match
+func (s *Store) FindActive(serverID string, matchID string) (Match, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.active[serverID+"/"+matchID]
+	if !ok {
+		return Match{}, false
+	}
+	return *s.matches[id], true
+}
+
+// Backfills returns the unfinished backfills of a game server match
+func (s *Store) Backfills(serverID string, matchID string) []Match {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var list []Match
+	for _, match := range s.backfills(serverID, matchID) {
+		list = append(list, *match)
+	}
+	return list
+}
+
+// Sent returns how many players of a mode were transferred to matches
+// since the given time, backfills included
+func (s *Store) Sent(mode string, since time.Time) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sent := 0
+	for _, match := range s.matches {
+		if match.Mode == mode && match.TransferredAt != nil && !match.TransferredAt.Before(since) {
+			sent += len(match.Players)
+		}
+	}
+	return sent
+}
+
+// List returns matches, newest first. Empty filters match everything.
+func (s *Store) List(state State, mode string) []Match {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Match, 0, len(s.matches))
+	for _, match := range s.matches {
+		if state != "" && match.State != state {
+			continue
+		}
+		if mode != "" && match.Mode != mode {
+			continue
+		}
+		list = append(list, *match)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list
+}
+
+// Restore replaces all matches with a snapshot
+func (s *Store) Restore(list []Match) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.matches = make(map[string]*Match, len(list))
+	s.active = make(map[string]string)
+	for i := range list {
+		match := list[i]
+		s.matches[match.ID] = &match
+		if match.Active() {
+			s.active[activeKey(&match)] = match.ID
+		}
+	}
+}
+
+func activeKey(match *Match) string {
+	key := match.ServerID + "/" + match.MatchID
+	if match.Backfill {
+		key += "/" + match.ID
+	}
+	return key
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,213 @@
+package penalties
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Reason is why a player was penalized
+type Reason string
+
+const (
+	ReasonDodge   Reason = "dodge"   // left the queue after a match was found
+	ReasonDecline Reason = "decline" // declined or ignored a ready check
+	ReasonNoShow  Reason = "no-show" // never arrived on the game server
+)
+
+// Offense is a single recorded offense
+type Offense struct {
+	Reason Reason    `json:"reason"`
+	At     time.Time `json:"at"`
+}
+
+// Penalty is a player's offense history and current queue ban
+type Penalty struct {
+	UUID     string    `json:"uuid"`
+	Offenses []Offense `json:"offenses"`
+	Until    time.Time `json:"until"` // queue joins are rejected until then
+}
+
+// BannedError is returned when a player tries to queue while banned
+type BannedError struct {
+	UUID      string
+	Remaining time.Duration
+}
+
+func (e *BannedError) Error() string {
+	return fmt.Sprintf("%s is banned from queueing for %s", e.UUID, e.Remaining.Round(time.Second))
+}
+
+// Tracker records offenses and applies escalating queue bans. The nth
+// recent offense bans for ladder[n-1], capped at the last step. Offenses
+// older than decay no longer count.
+type Tracker struct {
+	mu        sync.RWMutex
+	penalties map[string]*Penalty // key = player UUID
+	ladder    []time.Duration
+	decay     time.Duration
+}
+
+// NewTracker creates a new penalty tracker
+func NewTracker(ladder []time.Duration, decay time.Duration) *Tracker {
+	t := &Tracker{
+		penalties: make(map[string]*Penalty),
+		ladder:    ladder,
+		decay:     decay,
+	}
+
+	go t.cleanupLoop()
+
+	return t
+}
+
+// cleanupLoop forgets players with no recent offenses
+func (t *Tracker) cleanupLoop() {
+	ticker := time.NewTicker(time.Minute)
+	for range ticker.C {
+		t.cleanup()
+	}
+}
+
+// cleanup removes players whose ban expired and whose offenses all decayed
+func (t *Tracker) cleanup() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for uuid, p := range t.penalties {
+		if now.Before(p.Until) {
+			continue
+		}
+		if len(p.Offenses) > 0 && now.Sub(p.Offenses[len(p.Offenses)-1].At) < t.decay {
+			continue
+		}
+		delete(t.penalties, uuid)
+	}
+}
+
+// Record adds an offense and extends the player's ban
+func (t *Tracker) Record(uuid string, reason Reason) Penalty {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	p := t.penalties[uuid]
+	if p == nil {
+		p = &Penalty{UUID: uuid}
+		t.penalties[uuid] = p
+	}
+
+	// Forget offenses that have decayed
+	recent := p.Offenses[:0]
+	for _, offense := range p.Offenses {
+		if now.Sub(offense.At) < t.decay {
+			recent = append(recent, offense)
+		}
+	}
+	p.Offenses = append(recent, Offense{Reason: reason, At: now})
+
+	if len(t.ladder) > 0 {
+		step := min(len(p.Offenses), len(t.ladder)) - 1
+		p.Until = now.Add(t.ladder[step])
+	}
+
+	fmt.Printf("[Penalties] %s: %s (offense %d, banned until %s)\n", uuid, reason, len(p.Offenses), p.Until.Format(time.RFC3339))
+	return t.copy(p)
+}
+
+// Remaining returns how long a player is still banned, or 0
+func (t *Tracker) Remaining(uuid string) time.Duration {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	p := t.penalties[uuid]
+	if p == nil {
+		return 0
+	}
+	return max(time.Until(p.Until), 0)
+}
+
+// Check returns a BannedError for the first banned player, or nil
+func (t *Tracker) Check(uuids []string) error {
+	for _, uuid := range uuids {
+		if remaining := t.Remaining(uuid); remaining > 0 {
+			return &BannedError{UUID: uuid, Remaining: remaining}
+		}
+	}
+	return nil
+}
+
+// Penalized reports whether any of the players has offenses that haven't
+// decayed yet, banned or not
+func (t *Tracker) Penalized(uuids []string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	now := time.Now()
+	for _, uuid := range uuids {
+		p := t.penalties[uuid]
+		if p != nil && len(p.Offenses) > 0 && now.Sub(p.Offenses[len(p.Offenses)-1].At) < t.decay {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns a player's penalty
+func (t *Tracker) Get(uuid string) (Penalty, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	p := t.penalties[uuid]
+	if p == nil {
+		return Penalty{}, false
+	}
+	return t.copy(p), true
+}
+
+// List returns every player with offenses or a ban, ordered by ban expiry
+// with the longest first
+func (t *Tracker) List() []Penalty {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	list := make([]Penalty, 0, len(t.penalties))
+	for _, p := range t.penalties {
+		list = append(list, t.copy(p))
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Until.After(list[j].Until)
+	})
+	return list
+}
+
+// Clear removes a player's offenses and ban
+func (t *Tracker) Clear(uuid string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, ok := t.penalties[uuid]
+	delete(t.penalties, uuid)
+	return ok
+}
+
+// Restore replaces all penalties with a snapshot
+func (t *Tracker) Restore(list []Penalty) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.penalties = make(map[string]*Penalty, len(list))
+	for i := range list {
+		p := list[i]
+		t.penalties[p.UUID] = &p
+	}
+}
+
+func (t *Tracker) copy(p *Penalty) Penalty {
+	c := *p
+	c.Offenses = append([]Offense(nil), p.Offenses...)
+	return c
+}
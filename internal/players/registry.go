@@ -2,12 +2,14 @@ package players
 
 import (
 	"sync"
+	"time"
 )
 
 type Player struct {
-	UUID     string `json:"uuid"`
-	IP       string `json:"ip"`
-	ServerID string `json:"server_id"`
+	UUID         string    `json:"uuid"`
+	IP           string    `json:"ip"`
+	ServerID     string    `json:"server_id"`
+	RegisteredAt time.Time `json:"registered_at"`
 }
 
 type Registry struct {
@@ -27,7 +29,7 @@ func (r *Registry) Register(uuid, ip, serverID string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	player := &Player{UUID: uuid, IP: ip, ServerID: serverID}
+	player := &Player{UUID: uuid, IP: ip, ServerID: serverID, RegisteredAt: time.Now()}
 	r.byUUID[uuid] = player
 	r.byIP[ip] = player
 }
@@ -66,3 +68,31 @@ func (r *Registry) Remove(uuid string) {
 		delete(r.byUUID, uuid)
 	}
 }
+
+func (r *Registry) List() []Player {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]Player, 0, len(r.byUUID))
+	for _, player := range r.byUUID {
+		list = append(list, *player)
+	}
+	return list
+}
+
+func (r *Registry) Restore(list []Player) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.byUUID = make(map[string]*Player, len(list))
+	r.byIP = make(map[string]*Player, len(list))
+	for i := range list {
+		player := list[i]
+		r.byUUID[player.UUID] = &player
+
+		// An IP belongs to whoever registered from it last, as before the restart
+		if other, ok := r.byIP[player.IP]; !ok || player.RegisteredAt.After(other.RegisteredAt) {
+			r.byIP[player.IP] = &player
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package players
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRestoreKeepsLatestIPOwner(t *testing.T) {
+	now := time.Now()
+	route := Player{UUID: "10.0.0.1", IP: "10.0.0.1", RegisteredAt: now.Add(-time.Minute)}
+	player := Player{UUID: "player-1", IP: "10.0.0.1", ServerID: "lobby-1", RegisteredAt: now}
+
+	for _, list := range [][]Player{{route, player}, {player, route}} {
+		r := NewRegistry()
+		r.Restore(list)
+
+		got, ok := r.GetByIP("10.0.0.1")
+		if !ok || got.UUID != "player-1" {
+			t.Fatalf("IP restored to %+v, want player-1", got)
+		}
+		if _, ok := r.GetByUUID("10.0.0.1"); !ok {
+			t.Fatal("route entry lost")
+		}
+	}
+}
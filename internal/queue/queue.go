@@ -1,41 +1,351 @@
 package queue
 
 import (
+	"errors"
 	"fmt"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
-// QueueEntry represents a player waiting in queue
+// QueueEntry represents a player, or a party led by UUID, waiting in queue
 type QueueEntry struct {
 	UUID        string    `json:"uuid"`
+	Members     []string  `json:"members,omitempty"` // party members, excluding the leader
 	LobbyServer string    `json:"lobbyServer"`
+	Rating      float64   `json:"rating,omitempty"` // skill rating, averaged across a party
+	Modes       []string  `json:"modes,omitempty"`  // every mode the entry queued for, if more than one
+	Priority    Priority  `json:"priority,omitempty"`
+	Rejoined    bool      `json:"rejoined,omitempty"` // queued again automatically after timing out
 	JoinedAt    time.Time `json:"joinedAt"`
 }
 
-// Queue holds players waiting for a specific game mode
+// Priority is a queue tier. Entries in a higher tier are matched before
+// any entry in a lower one, until the lower entry has waited too long.
+type Priority string
+
+const (
+	PriorityVIP     Priority = "vip"     // bought queue priority
+	PriorityRequeue Priority = "requeue" // back for another match straight after the last
+	PriorityNormal  Priority = "normal"  // the default, also used when empty
+	PriorityLow     Priority = "low"     // penalized players
+)
+
+// Valid reports whether p is a known tier. Empty counts as normal.
+func (p Priority) Valid() bool {
+	switch p {
+	case "", PriorityVIP, PriorityRequeue, PriorityNormal, PriorityLow:
+		return true
+	}
+	return false
+}
+
+// AtLeast returns p, or other if that is a higher tier
+func (p Priority) AtLeast(other Priority) Priority {
+	if other.tier() < p.tier() {
+		return other
+	}
+	return p
+}
+
+// tier returns the priority's rank, 0 being matched first
+func (p Priority) tier() int {
+	switch p {
+	case PriorityVIP:
+		return 0
+	case PriorityRequeue:
+		return 1
+	case PriorityLow:
+		return 3
+	}
+	return 2
+}
+
+// Players returns the leader followed by any party members
+func (e QueueEntry) Players() []string {
+	return append([]string{e.UUID}, e.Members...)
+}
+
+// Size returns the number of players the entry occupies in a match
+func (e QueueEntry) Size() int {
+	return 1 + len(e.Members)
+}
+
+// Validate checks that every player in the entry has a UUID and appears
+// once, so Size counts real players
+func (e QueueEntry) Validate() error {
+	seen := make(map[string]bool, e.Size())
+	for _, uuid := range e.Players() {
+		if uuid == "" {
+			return errors.New("empty player UUID in party")
+		}
+		if seen[uuid] {
+			return fmt.Errorf("%s is in the party more than once", uuid)
+		}
+		seen[uuid] = true
+	}
+	return nil
+}
+
+// Has reports whether uuid is the leader or a member of the entry
+func (e QueueEntry) Has(uuid string) bool {
+	if e.UUID == uuid {
+		return true
+	}
+	for _, member := range e.Members {
+		if member == uuid {
+			return true
+		}
+	}
+	return false
+}
+
+// Queue holds players waiting for a specific game mode. Entries are kept
+// in a tree ordered by priority tier, then sequence number: joins take the
+// next number at the back, entries put back at the front take numbers
+// below the first. Each entry stays at the front or back of its own tier.
 type Queue struct {
-	entries []QueueEntry
+	mu    sync.RWMutex
+	tree  tree
+	keys  map[string]key // leader UUID → position in the tree
+	front int64          // lowest sequence number handed out
+	back  int64          // highest sequence number handed out
+	flat  bool           // every entry in the normal tier
+}
+
+func newQueue(flat bool) *Queue {
+	return &Queue{keys: make(map[string]key), flat: flat}
+}
+
+// tier returns the tier an entry queues in
+func (q *Queue) tier(entry QueueEntry) int {
+	if q.flat {
+		return PriorityNormal.tier()
+	}
+	return entry.Priority.tier()
+}
+
+// setFlat turns priority tiers off or on, moving every entry to its new
+// tier. Entries keep their sequence numbers, so a flat queue is in arrival
+// order.
+func (q *Queue) setFlat(flat bool) {
+	if q.flat == flat {
+		return
+	}
+	q.flat = flat
+
+	var nodes []*node
+	q.tree.each(func(n *node) bool {
+		nodes = append(nodes, n)
+		return true
+	})
+
+	q.tree = tree{}
+	for _, n := range nodes {
+		k := key{q.tier(n.entry), n.key.seq}
+		q.keys[n.entry.UUID] = k
+		q.tree.insert(k, n.entry)
+	}
+}
+
+// push adds an entry at the back of its tier, unless its leader is
+// already queued
+func (q *Queue) push(entry QueueEntry) bool {
+	if _, ok := q.keys[entry.UUID]; ok {
+		return false
+	}
+	q.back++
+	k := key{q.tier(entry), q.back}
+	q.keys[entry.UUID] = k
+	q.tree.insert(k, entry)
+	return true
+}
+
+// pushFront adds entries at the front of their tiers, in the order given
+func (q *Queue) pushFront(entries []QueueEntry) {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if _, ok := q.keys[entries[i].UUID]; ok {
+			continue
+		}
+		q.front--
+		k := key{q.tier(entries[i]), q.front}
+		q.keys[entries[i].UUID] = k
+		q.tree.insert(k, entries[i])
+	}
+}
+
+// remove deletes the entry led by leader
+func (q *Queue) remove(leader string) (QueueEntry, bool) {
+	k, ok := q.keys[leader]
+	if !ok {
+		return QueueEntry{}, false
+	}
+	delete(q.keys, leader)
+	return q.tree.delete(k)
+}
+
+// promote moves the entry led by leader to the top tier, keeping its
+// sequence number so it sorts by how long it has queued
+func (q *Queue) promote(leader string) bool {
+	k, ok := q.keys[leader]
+	if !ok || k.tier == 0 {
+		return false
+	}
+	entry, _ := q.tree.delete(k)
+	k.tier = 0
+	q.keys[leader] = k
+	q.tree.insert(k, entry)
+	return true
+}
+
+// moveFront moves the entry led by leader to the front of the top tier
+func (q *Queue) moveFront(leader string) bool {
+	k, ok := q.keys[leader]
+	if !ok {
+		return false
+	}
+	entry, _ := q.tree.delete(k)
+	q.front--
+	k = key{q.tier(QueueEntry{Priority: PriorityVIP}), q.front}
+	q.keys[leader] = k
+	q.tree.insert(k, entry)
+	return true
+}
+
+// entry returns the entry led by leader, for updating in place
+func (q *Queue) entry(leader string) *QueueEntry {
+	k, ok := q.keys[leader]
+	if !ok {
+		return nil
+	}
+	return &q.tree.get(k).entry
+}
+
+// position returns the number of players up to and including the entry
+// led by leader
+func (q *Queue) position(leader string) (int, bool) {
+	k, ok := q.keys[leader]
+	if !ok {
+		return 0, false
+	}
+	return q.tree.rank(k), true
+}
+
+// list returns up to n entries in queue order, or all of them if n < 0
+func (q *Queue) list(n int) []QueueEntry {
+	if n < 0 || n > q.tree.len() {
+		n = q.tree.len()
+	}
+
+	entries := make([]QueueEntry, 0, n)
+	q.tree.each(func(node *node) bool {
+		if len(entries) == n {
+			return false
+		}
+		entries = append(entries, node.entry)
+		return true
+	})
+	return entries
+}
+
+// ExpiredHook is called after an entry timed out, with every mode it was
+// removed from. It runs on the cleanup goroutine, outside any queue lock.
+type ExpiredHook func(entry QueueEntry, modes []string)
+
+// ModeCheck decides whether an entry of size players may join a mode. A
+// non-nil error rejects the join and is returned to the caller.
+type ModeCheck func(mode string, size int) error
+
+// Guard decides whether players may join a queue. A non-nil error rejects
+// the join and is returned to the caller.
+type Guard func(uuids []string) error
+
+// JoinPolicy decides what happens when a queued player joins other modes
+type JoinPolicy string
+
+const (
+	JoinReject JoinPolicy = "reject" // refuse the join
+	JoinMove   JoinPolicy = "move"   // leave the current queues, then join
+	JoinAdd    JoinPolicy = "add"    // stay queued and also join the new modes
+)
+
+// AlreadyQueuedError is returned when a queued player joins other modes and
+// the join policy doesn't allow it
+type AlreadyQueuedError struct {
+	UUID  string
+	Modes []string
+}
+
+func (e *AlreadyQueuedError) Error() string {
+	return fmt.Sprintf("%s is already queued for %s", e.UUID, strings.Join(e.Modes, ", "))
+}
+
+// Ticket describes a queued entry
+type Ticket struct {
+	Leader   string    `json:"leader"`
+	Modes    []string  `json:"modes"`
+	JoinedAt time.Time `json:"joinedAt"`
+	Repeat   bool      `json:"-"` // the join found the entry already queued
+}
+
+// ticket is the index record shared by every player of a queued entry
+type ticket struct {
+	leader   string
+	size     int
+	modes    []string
+	joinedAt time.Time
 }
 
-// Manager manages all queues by game mode
+// Manager manages all queues by game mode.
+//
+// Each queue has its own lock, so work on one mode never waits for another.
+// An operation that touches several modes, such as taking a multi-mode
+// entry, locks every queue involved in mode order and then the player
+// index. The index lock is always taken last and never held while waiting
+// for a queue.
 type Manager struct {
-	mu      sync.RWMutex
-	queues  map[string]*Queue // key = mode (e.g., "skywars")
-	timeout time.Duration
+	mu     sync.RWMutex
+	queues map[string]*Queue // key = mode (e.g., "skywars"), never removed
+
+	indexMu sync.Mutex
+	index   map[string]*ticket // player UUID → their entry, across all modes
+	guard   Guard
+	check   ModeCheck
+	policy  JoinPolicy
+	maxWait time.Duration // how long before an entry jumps to the top tier, 0 = never
+	timeout time.Duration // how long entries may wait, 0 = forever
+	rules   RuleSource
+	expired ExpiredHook
+	paused  map[string]bool // modes that aren't matched, though players may still join
+}
+
+// RuleSource returns the rules for a mode, or false to use the manager's
+// timeout and max wait, with priority tiers. It is called with the index
+// lock held, so it must not call back into the manager.
+type RuleSource func(mode string) (Rules, bool)
+
+// Rules override the manager's timeout and priority settings for one mode
+type Rules struct {
+	Timeout time.Duration // how long entries may wait, 0 = forever
+	MaxWait time.Duration // how long before an entry jumps to the top tier, 0 = never
+	Flat    bool          // ignore priority tiers and queue strictly by arrival
 }
 
 // NewManager creates a new queue manager
 func NewManager(timeout time.Duration) (*Manager, error) {
 	m := &Manager{
 		queues:  make(map[string]*Queue),
+		index:   make(map[string]*ticket),
+		paused:  make(map[string]bool),
 		timeout: timeout,
+		policy:  JoinReject,
 	}
 
-	// Start cleanup goroutine if timeout enabled
-	if timeout > 0 {
-		go m.cleanupLoop()
-	}
+	// Timeouts and priority waits may also be set per mode later
+	go m.cleanupLoop()
+	go m.agingLoop()
 
 	return m, nil
 }
@@ -48,102 +358,870 @@ func (m *Manager) cleanupLoop() {
 	}
 }
 
-// cleanup removes entries older than timeout
+// cleanup removes entries older than their mode's timeout from every
+// queue they joined. Each queue is scanned under its own read lock, and
+// expired entries are removed one at a time, so joins carry on while a
+// large queue is checked.
 func (m *Manager) cleanup() {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.indexMu.Lock()
+	hook := m.expired
+	m.indexMu.Unlock()
+
+	for _, mode := range m.Modes() {
+		timeout := m.Rules(mode).Timeout
+		if timeout <= 0 {
+			continue
+		}
+		q := m.get(mode)
 
-	now := time.Now()
-	for mode, q := range m.queues {
-		var kept []QueueEntry
-		for _, entry := range q.entries {
-			if now.Sub(entry.JoinedAt) < m.timeout {
-				kept = append(kept, entry)
-			} else {
-				fmt.Printf("[Queue] Timeout: %s removed from %s (waited %s)\n", entry.UUID, mode, now.Sub(entry.JoinedAt))
+		now := time.Now()
+		var expired []QueueEntry
+		q.mu.RLock()
+		q.tree.each(func(n *node) bool {
+			if now.Sub(n.entry.JoinedAt) >= timeout {
+				expired = append(expired, n.entry)
 			}
+			return true
+		})
+		q.mu.RUnlock()
+
+		for _, entry := range expired {
+			modes := m.expire(mode, entry)
+			if len(modes) == 0 {
+				continue
+			}
+
+			fmt.Printf("[Queue] Timeout: %s removed from %s (waited %s)\n", entry.UUID, strings.Join(modes, ", "), now.Sub(entry.JoinedAt))
+			if hook != nil {
+				hook(entry, modes)
+			}
+		}
+	}
+}
+
+// expire removes an entry found expired from every queue it joined, unless
+// it left or was put back with a new join time meanwhile. Returns the modes
+// it was removed from.
+func (m *Manager) expire(mode string, entry QueueEntry) []string {
+	var modes []string
+	m.withPlayers([]string{entry.UUID}, []string{mode}, false, func() {
+		q := m.queues[mode]
+		if q == nil {
+			return
+		}
+		queued := q.entry(entry.UUID)
+		if queued == nil || !queued.JoinedAt.Equal(entry.JoinedAt) {
+			return
+		}
+
+		modes = append([]string(nil), m.index[entry.UUID].modes...)
+		for _, mode := range modes {
+			m.remove(mode, entry.UUID)
+		}
+	})
+	sort.Strings(modes)
+	return modes
+}
+
+// agingLoop promotes entries that have waited too long
+func (m *Manager) agingLoop() {
+	ticker := time.NewTicker(time.Second)
+	for range ticker.C {
+		m.age()
+	}
+}
+
+// age moves entries that have waited at least maxWait to the top tier, so
+// a steady stream of higher priority joins can't hold them back forever.
+// Each queue is scanned under its read lock and only locked for writing
+// when something needs promoting.
+func (m *Manager) age() {
+	for _, mode := range m.Modes() {
+		maxWait := m.Rules(mode).MaxWait
+		if maxWait <= 0 {
+			continue
+		}
+		q := m.get(mode)
+
+		now := time.Now()
+		var waited []string
+		q.mu.RLock()
+		if q.flat {
+			q.mu.RUnlock()
+			continue
+		}
+		q.tree.each(func(n *node) bool {
+			if n.key.tier > 0 && now.Sub(n.entry.JoinedAt) >= maxWait {
+				waited = append(waited, n.entry.UUID)
+			}
+			return true
+		})
+		q.mu.RUnlock()
+		if len(waited) == 0 {
+			continue
+		}
+
+		q.mu.Lock()
+		for _, leader := range waited {
+			// The entry may have left and joined again meanwhile
+			entry := q.entry(leader)
+			if entry == nil || now.Sub(entry.JoinedAt) < maxWait {
+				continue
+			}
+			if q.promote(leader) {
+				fmt.Printf("[Queue] %s promoted in %s after waiting %s\n", leader, mode, maxWait)
+			}
+		}
+		q.mu.Unlock()
+	}
+}
+
+// SetMaxWait sets how long an entry waits before it is matched ahead of
+// every tier, 0 to keep tiers strict
+func (m *Manager) SetMaxWait(maxWait time.Duration) {
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+
+	m.maxWait = maxWait
+}
+
+// SetRuleSource installs where per-mode rules come from. Rules are looked
+// up each time they are needed, so a source may change them at any time,
+// but should call Retier after turning priority tiers on or off.
+func (m *Manager) SetRuleSource(source RuleSource) {
+	m.indexMu.Lock()
+	m.rules = source
+	m.indexMu.Unlock()
+
+	m.Retier()
+}
+
+// Retier moves the entries of every queue into the tiers its mode's rules
+// call for, after priority tiers were turned on or off
+func (m *Manager) Retier() {
+	for _, mode := range m.Modes() {
+		flat := m.Rules(mode).Flat
+		q := m.get(mode)
+		q.mu.Lock()
+		q.setFlat(flat)
+		q.mu.Unlock()
+	}
+}
+
+// Rules returns the rules in effect for a mode
+func (m *Manager) Rules(mode string) Rules {
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+
+	return m.rulesLocked(mode)
+}
+
+// rulesLocked is Rules for callers holding indexMu
+func (m *Manager) rulesLocked(mode string) Rules {
+	if m.rules != nil {
+		if rules, ok := m.rules(mode); ok {
+			return rules
 		}
-		q.entries = kept
 	}
+	return Rules{Timeout: m.timeout, MaxWait: m.maxWait}
+}
+
+// SetExpiredHook installs a callback for entries that timed out
+func (m *Manager) SetExpiredHook(hook ExpiredHook) {
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+
+	m.expired = hook
 }
 
-// Join adds a player to a queue
-func (m *Manager) Join(mode string, entry QueueEntry) {
+// SetGuard installs a check run on every Join
+func (m *Manager) SetGuard(guard Guard) {
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+
+	m.guard = guard
+}
+
+// SetModeCheck installs a check run for every mode of every Join
+func (m *Manager) SetModeCheck(check ModeCheck) {
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+
+	m.check = check
+}
+
+// CheckMode reports whether an entry of size players may join a mode
+func (m *Manager) CheckMode(mode string, size int) error {
+	m.indexMu.Lock()
+	check := m.check
+	m.indexMu.Unlock()
+
+	if check == nil {
+		return nil
+	}
+	return check(mode, size)
+}
+
+// SetPolicy decides what happens when a queued player joins other modes
+func (m *Manager) SetPolicy(policy JoinPolicy) {
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+
+	m.policy = policy
+}
+
+// Pause stops matching a mode until it is resumed. Players may still join
+// and leave, and entries still time out. Returns false if already paused.
+func (m *Manager) Pause(mode string) bool {
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+
+	if m.paused[mode] {
+		return false
+	}
+	m.paused[mode] = true
+	return true
+}
+
+// Resume lets a paused mode be matched again. Returns false if it wasn't
+// paused.
+func (m *Manager) Resume(mode string) bool {
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+
+	if !m.paused[mode] {
+		return false
+	}
+	delete(m.paused, mode)
+	return true
+}
+
+// IsPaused reports whether matching is paused for a mode
+func (m *Manager) IsPaused(mode string) bool {
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+
+	return m.paused[mode]
+}
+
+// Paused returns every paused mode, sorted
+func (m *Manager) Paused() []string {
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+
+	modes := make([]string, 0, len(m.paused))
+	for mode := range m.paused {
+		modes = append(modes, mode)
+	}
+	sort.Strings(modes)
+	return modes
+}
+
+// get returns a mode's queue, creating it if needed
+func (m *Manager) get(mode string) *Queue {
+	m.mu.RLock()
+	q := m.queues[mode]
+	m.mu.RUnlock()
+	if q != nil {
+		return q
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if m.queues[mode] == nil {
-		m.queues[mode] = &Queue{}
+	if q = m.queues[mode]; q == nil {
+		q = newQueue(m.Rules(mode).Flat)
+		m.queues[mode] = q
+	}
+	return q
+}
+
+// find returns a mode's queue, or nil if nobody has joined it yet
+func (m *Manager) find(mode string) *Queue {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.queues[mode]
+}
+
+// withPlayers runs fn holding the write lock of every queue the players
+// are in, plus the given modes, and then the index lock. The queues are
+// looked up from the index, locked in mode order, and the lookup is
+// repeated under the locks in case the players moved meanwhile.
+//
+// Only callers adding entries set create; otherwise a given mode without a
+// queue stays without one, so a leave for an unknown mode can't create it.
+//
+// Inside fn, m.queues may be read for the locked modes, and the index used
+// freely. m.queues[mode] is nil for a given mode without a queue.
+func (m *Manager) withPlayers(uuids []string, modes []string, create bool, fn func()) {
+	for {
+		wanted := m.involved(uuids, modes)
+
+		locked := make([]*Queue, len(wanted))
+		for i, mode := range wanted {
+			if create {
+				locked[i] = m.get(mode)
+			} else if locked[i] = m.find(mode); locked[i] == nil {
+				continue
+			}
+			locked[i].mu.Lock()
+		}
+
+		m.mu.RLock()
+		m.indexMu.Lock()
+		ok := subset(m.involvedLocked(uuids, modes), wanted)
+		for i, mode := range wanted {
+			// A queue created meanwhile isn't locked
+			ok = ok && m.queues[mode] == locked[i]
+		}
+		if ok {
+			fn()
+		}
+		m.indexMu.Unlock()
+		m.mu.RUnlock()
+
+		for i := len(locked) - 1; i >= 0; i-- {
+			if locked[i] != nil {
+				locked[i].mu.Unlock()
+			}
+		}
+		if ok {
+			return
+		}
+	}
+}
+
+// involved returns the modes the players are queued in, plus the given
+// modes, sorted
+func (m *Manager) involved(uuids []string, modes []string) []string {
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+
+	return m.involvedLocked(uuids, modes)
+}
+
+// involvedLocked is involved for callers holding indexMu
+func (m *Manager) involvedLocked(uuids []string, modes []string) []string {
+	all := append([]string(nil), modes...)
+	for _, t := range m.tickets(uuids) {
+		all = append(all, t.modes...)
+	}
+	slices.Sort(all)
+	return slices.Compact(all)
+}
+
+// Join adds a player to a queue, unless the guard rejects them
+func (m *Manager) Join(mode string, entry QueueEntry) (Ticket, error) {
+	return m.JoinModes([]string{mode}, entry)
+}
+
+// JoinModes adds a player to several queues at once, unless the entry is
+// invalid or the mode check or the guard rejects them. Once the entry is taken from one queue it is removed from
+// all the others.
+//
+// Joining again with the same entry and modes changes nothing and returns
+// the existing ticket. If any of the players is already queued otherwise,
+// the join policy decides.
+func (m *Manager) JoinModes(modes []string, entry QueueEntry) (Ticket, error) {
+	if err := entry.Validate(); err != nil {
+		return Ticket{}, err
+	}
+	for _, mode := range modes {
+		if err := m.CheckMode(mode, entry.Size()); err != nil {
+			return Ticket{}, err
+		}
+	}
+
+	var ticket Ticket
+	var err error
+	m.withPlayers(entry.Players(), modes, true, func() {
+		ticket, err = m.join(modes, entry)
+	})
+	return ticket, err
+}
+
+// join is JoinModes for callers inside withPlayers
+func (m *Manager) join(modes []string, entry QueueEntry) (Ticket, error) {
+	existing := m.tickets(entry.Players())
+	same := len(existing) == 1 && existing[0].leader == entry.UUID && existing[0].size == entry.Size()
+	if same && subset(modes, existing[0].modes) {
+		return existing[0].export(true), nil
+	}
+
+	if len(existing) > 0 {
+		switch {
+		case m.policy == JoinMove:
+			for _, t := range existing {
+				for _, mode := range append([]string(nil), t.modes...) {
+					m.remove(mode, t.leader)
+				}
+			}
+		case m.policy == JoinAdd && same:
+			t := existing[0]
+			var added []string
+			for _, mode := range modes {
+				if !slices.Contains(t.modes, mode) {
+					added = append(added, mode)
+				}
+			}
+			if m.guard != nil {
+				if err := m.guard(entry.Players()); err != nil {
+					return Ticket{}, err
+				}
+			}
+			return m.addModes(t, entry, added), nil
+		default:
+			uuid := entry.UUID
+			for _, player := range entry.Players() {
+				if m.index[player] != nil {
+					uuid = player
+					break
+				}
+			}
+			return Ticket{}, &AlreadyQueuedError{UUID: uuid, Modes: append([]string(nil), m.index[uuid].modes...)}
+		}
+	}
+
+	if m.guard != nil {
+		if err := m.guard(entry.Players()); err != nil {
+			return Ticket{}, err
+		}
 	}
 
+	entry.Modes = nil
+	if len(modes) > 1 {
+		entry.Modes = append([]string(nil), modes...)
+	}
 	entry.JoinedAt = time.Now()
-	m.queues[mode].entries = append(m.queues[mode].entries, entry)
+
+	for _, mode := range modes {
+		m.queues[mode].push(entry)
+		m.track(mode, entry)
+	}
+	return m.index[entry.UUID].export(false), nil
+}
+
+// addModes queues an already queued entry for more modes, keeping its
+// original join time. Callers must be inside withPlayers.
+func (m *Manager) addModes(t *ticket, entry QueueEntry, added []string) Ticket {
+	all := append(append([]string(nil), t.modes...), added...)
+
+	// Every copy of the entry lists every mode
+	for _, mode := range t.modes {
+		if queued := m.queues[mode].entry(t.leader); queued != nil {
+			queued.Modes = all
+		}
+	}
+
+	entry.Modes = all
+	entry.JoinedAt = t.joinedAt
+	for _, mode := range added {
+		m.queues[mode].push(entry)
+		m.track(mode, entry)
+	}
+	return t.export(false)
+}
+
+// PushFront puts entries back at the front of a queue, in the order given.
+// Entries keep their JoinedAt; a zero JoinedAt is set to now. Entries that
+// queued for several modes go back to the front of each of them. Entries
+// with a player who has queued again since are dropped.
+func (m *Manager) PushFront(mode string, entries ...QueueEntry) {
+	m.pushFront(mode, entries, false)
+}
+
+// Requeue is PushFront for players coming back from a match, rather than
+// a match that failed to start. The mode check and the guard run again, so
+// entries only return to modes that still take them, and not at all if
+// any player is banned. Returns the entries that were refused.
+func (m *Manager) Requeue(mode string, entries ...QueueEntry) []QueueEntry {
+	return m.pushFront(mode, entries, true)
+}
+
+// pushFront is PushFront, running the mode check and the guard first if
+// checked is set. Returns the entries they refused.
+func (m *Manager) pushFront(mode string, entries []QueueEntry, checked bool) []QueueEntry {
+	var refused, returning []QueueEntry
+	var uuids, modes []string
+	for _, entry := range entries {
+		queued := entry.Modes
+		if len(queued) == 0 {
+			queued = []string{mode}
+		}
+		if checked {
+			var allowed []string
+			for _, other := range queued {
+				if err := m.CheckMode(other, entry.Size()); err != nil {
+					fmt.Printf("[Queue] %s can't return to %s: %v\n", entry.UUID, other, err)
+					continue
+				}
+				allowed = append(allowed, other)
+			}
+			if len(allowed) == 0 {
+				refused = append(refused, entry)
+				continue
+			}
+			queued = allowed
+		}
+
+		// Modes is only kept for entries in more than one queue
+		entry.Modes = queued
+		returning = append(returning, entry)
+		uuids = append(uuids, entry.Players()...)
+		modes = append(modes, queued...)
+	}
+	if len(returning) == 0 {
+		return refused
+	}
+
+	m.withPlayers(uuids, modes, true, func() {
+		now := time.Now()
+		fronts := make(map[string][]QueueEntry)
+		for _, entry := range returning {
+			if len(m.tickets(entry.Players())) > 0 {
+				fmt.Printf("[Queue] %s already queued again, not returning them to %s\n", entry.UUID, mode)
+				continue
+			}
+			if checked && m.guard != nil {
+				if err := m.guard(entry.Players()); err != nil {
+					fmt.Printf("[Queue] %s can't return to %s: %v\n", entry.UUID, mode, err)
+					refused = append(refused, entry)
+					continue
+				}
+			}
+			if entry.JoinedAt.IsZero() {
+				entry.JoinedAt = now
+			}
+
+			queued := entry.Modes
+			if len(queued) == 1 {
+				entry.Modes = nil
+			}
+			for _, mode := range queued {
+				fronts[mode] = append(fronts[mode], entry)
+			}
+		}
+
+		for mode, front := range fronts {
+			m.queues[mode].pushFront(front)
+			for _, entry := range front {
+				m.track(mode, entry)
+			}
+		}
+	})
+	return refused
 }
 
-// Leave removes a player from a queue
+// Leave removes a player from a queue. If the player is in a party, the
+// whole party is removed. The entry stays queued for any other modes.
 func (m *Manager) Leave(mode string, uuid string) bool {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	left := false
+	m.withPlayers([]string{uuid}, []string{mode}, false, func() {
+		_, left = m.leave(mode, uuid)
+	})
+	return left
+}
 
-	q := m.queues[mode]
-	if q == nil {
-		return false
+// leave is Leave for callers inside withPlayers
+func (m *Manager) leave(mode string, uuid string) (QueueEntry, bool) {
+	entry, ok := m.remove(mode, uuid)
+	if !ok {
+		return QueueEntry{}, false
 	}
 
-	for i, entry := range q.entries {
-		if entry.UUID == uuid {
-			q.entries = append(q.entries[:i], q.entries[i+1:]...)
-			return true
+	// The other copies no longer include this mode
+	var modes []string
+	for _, other := range entry.Modes {
+		if other != mode {
+			modes = append(modes, other)
 		}
 	}
-	return false
+	if len(modes) == 1 {
+		modes = nil
+	}
+	for _, other := range entry.Modes {
+		if other == mode {
+			continue
+		}
+		if queued := m.queues[other].entry(entry.UUID); queued != nil {
+			queued.Modes = modes
+		}
+	}
+	return entry, true
 }
 
-// Pop removes and returns n players from the front of a queue (FIFO)
-func (m *Manager) Pop(mode string, n int) []QueueEntry {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// Clear removes every entry from a queue, returning them. Entries stay
+// queued for any other modes. Entries joining while the queue is cleared
+// may be kept.
+func (m *Manager) Clear(mode string) []QueueEntry {
+	entries := m.Entries(mode)
+	if len(entries) == 0 {
+		return nil
+	}
+
+	leaders := make([]string, len(entries))
+	for i, entry := range entries {
+		leaders[i] = entry.UUID
+	}
+
+	var cleared []QueueEntry
+	m.withPlayers(leaders, []string{mode}, false, func() {
+		for _, leader := range leaders {
+			if entry, ok := m.leave(mode, leader); ok {
+				cleared = append(cleared, entry)
+			}
+		}
+	})
+	return cleared
+}
+
+// MoveToFront puts the entry holding uuid ahead of every other entry in a
+// queue, including higher priority tiers. Its place in other modes is
+// unchanged. Returns false if the player isn't in the queue.
+func (m *Manager) MoveToFront(mode string, uuid string) bool {
+	moved := false
+	m.withPlayers([]string{uuid}, []string{mode}, false, func() {
+		if t := m.index[uuid]; t != nil && m.queues[mode] != nil {
+			moved = m.queues[mode].moveFront(t.leader)
+		}
+	})
+	return moved
+}
+
+// LeaveAll removes a player from every queue, returning the modes they left
+func (m *Manager) LeaveAll(uuid string) []string {
+	var left []string
+	m.withPlayers([]string{uuid}, nil, false, func() {
+		t := m.index[uuid]
+		if t == nil {
+			return
+		}
 
+		left = append([]string(nil), t.modes...)
+		for _, mode := range left {
+			m.remove(mode, t.leader)
+		}
+	})
+	sort.Strings(left)
+	return left
+}
+
+// remove deletes the entry containing uuid from a queue. Callers must be
+// inside withPlayers.
+func (m *Manager) remove(mode string, uuid string) (QueueEntry, bool) {
 	q := m.queues[mode]
-	if q == nil || len(q.entries) < n {
+	t := m.index[uuid]
+	if q == nil || t == nil {
+		return QueueEntry{}, false
+	}
+
+	entry, ok := q.remove(t.leader)
+	if ok {
+		m.untrack(mode, entry)
+	}
+	return entry, ok
+}
+
+// track indexes an entry added to a queue. Callers must hold indexMu.
+func (m *Manager) track(mode string, entry QueueEntry) {
+	t := m.index[entry.UUID]
+	if t == nil || t.leader != entry.UUID {
+		t = &ticket{leader: entry.UUID, size: entry.Size(), joinedAt: entry.JoinedAt}
+		for _, uuid := range entry.Players() {
+			m.index[uuid] = t
+		}
+	}
+	if !slices.Contains(t.modes, mode) {
+		t.modes = append(t.modes, mode)
+	}
+}
+
+// untrack unindexes an entry removed from a queue. Callers must hold indexMu.
+func (m *Manager) untrack(mode string, entry QueueEntry) {
+	t := m.index[entry.UUID]
+	if t == nil {
+		return
+	}
+
+	var modes []string
+	for _, queued := range t.modes {
+		if queued != mode {
+			modes = append(modes, queued)
+		}
+	}
+	t.modes = modes
+
+	if len(t.modes) == 0 {
+		for _, uuid := range entry.Players() {
+			if m.index[uuid] == t {
+				delete(m.index, uuid)
+			}
+		}
+	}
+}
+
+// tickets returns the distinct entries the given players are queued in.
+// Callers must hold indexMu.
+func (m *Manager) tickets(uuids []string) []*ticket {
+	var list []*ticket
+	for _, uuid := range uuids {
+		if t := m.index[uuid]; t != nil && !slices.Contains(list, t) {
+			list = append(list, t)
+		}
+	}
+	return list
+}
+
+func (t *ticket) export(repeat bool) Ticket {
+	return Ticket{
+		Leader:   t.leader,
+		Modes:    append([]string(nil), t.modes...),
+		JoinedAt: t.joinedAt,
+		Repeat:   repeat,
+	}
+}
+
+// Lookup returns the entry a player is queued in
+func (m *Manager) Lookup(uuid string) (Ticket, bool) {
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+
+	t := m.index[uuid]
+	if t == nil {
+		return Ticket{}, false
+	}
+	return t.export(false), true
+}
+
+// Position returns how many players are queued in a mode up to and
+// including the entry holding uuid, or false if the player isn't queued there
+func (m *Manager) Position(mode string, uuid string) (int, bool) {
+	t, ok := m.Lookup(uuid)
+	q := m.find(mode)
+	if !ok || q == nil {
+		return 0, false
+	}
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	return q.position(t.Leader)
+}
+
+func subset(list []string, of []string) bool {
+	for _, s := range list {
+		if !slices.Contains(of, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// Selector picks entries to pop from a queue. It receives the entries in
+// FIFO order and returns the indices to remove, or nil to remove nothing.
+type Selector func(entries []QueueEntry) []int
+
+// Fill returns a Selector that takes entries totalling exactly n players in
+// FIFO order. Parties are never split: a party that doesn't fit in the
+// remaining slots is skipped and keeps its place.
+func Fill(n int) Selector {
+	return func(entries []QueueEntry) []int {
+		if n <= 0 {
+			return nil
+		}
+
+		var picked []int
+		remaining := n
+		for i, entry := range entries {
+			if entry.Size() <= remaining {
+				picked = append(picked, i)
+				remaining -= entry.Size()
+				if remaining == 0 {
+					return picked
+				}
+			}
+		}
 		return nil
 	}
+}
 
-	entries := make([]QueueEntry, n)
-	copy(entries, q.entries[:n])
-	q.entries = q.entries[n:]
-	return entries
+// Take removes exactly the given entries from this queue and every other
+// queue they joined. It is all-or-nothing: if any entry has left the queue,
+// or was replaced by a new join of the same leader, nothing is removed and
+// false is returned.
+func (m *Manager) Take(mode string, entries []QueueEntry) bool {
+	if len(entries) == 0 {
+		return false
+	}
+
+	leaders := make([]string, len(entries))
+	for i, entry := range entries {
+		leaders[i] = entry.UUID
+	}
+
+	taken := false
+	m.withPlayers(leaders, []string{mode}, false, func() {
+		q := m.queues[mode]
+		if q == nil {
+			return
+		}
+		for _, entry := range entries {
+			queued := q.entry(entry.UUID)
+			if queued == nil || !queued.JoinedAt.Equal(entry.JoinedAt) || !slices.Equal(queued.Members, entry.Members) {
+				return
+			}
+		}
+
+		// Take every copy, including those in other modes
+		for _, leader := range leaders {
+			t := m.index[leader]
+			for _, queued := range append([]string(nil), t.modes...) {
+				m.remove(queued, leader)
+			}
+		}
+		taken = true
+	})
+	return taken
 }
 
-// Size returns the number of players in a queue
+// Size returns the number of players in a queue, counting every party member
 func (m *Manager) Size(mode string) int {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	q := m.queues[mode]
+	q := m.find(mode)
 	if q == nil {
 		return 0
 	}
-	return len(q.entries)
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	return q.tree.players()
 }
 
 // Peek returns players without removing them
 func (m *Manager) Peek(mode string, n int) []QueueEntry {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	q := m.queues[mode]
+	q := m.find(mode)
 	if q == nil {
 		return nil
 	}
 
-	if n > len(q.entries) {
-		n = len(q.entries)
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	return q.list(max(n, 0))
+}
+
+// Entries returns a copy of every entry in a queue, in queue order
+func (m *Manager) Entries(mode string) []QueueEntry {
+	q := m.find(mode)
+	if q == nil {
+		return nil
 	}
 
-	entries := make([]QueueEntry, n)
-	copy(entries, q.entries[:n])
-	return entries
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	return q.list(-1)
 }
 
 // Modes returns all active queue modes
@@ -157,3 +1235,55 @@ func (m *Manager) Modes() []string {
 	}
 	return modes
 }
+
+// Snapshot returns a copy of every queue's entries, keyed by mode. Every
+// queue is locked at once so multi-mode entries are captured consistently.
+func (m *Manager) Snapshot() map[string][]QueueEntry {
+	modes := m.Modes()
+	sort.Strings(modes)
+
+	queues := make([]*Queue, len(modes))
+	for i, mode := range modes {
+		queues[i] = m.get(mode)
+		queues[i].mu.RLock()
+	}
+	defer func() {
+		for _, q := range queues {
+			q.mu.RUnlock()
+		}
+	}()
+
+	snapshot := make(map[string][]QueueEntry, len(modes))
+	for i, mode := range modes {
+		if queues[i].tree.len() == 0 {
+			continue
+		}
+		snapshot[mode] = queues[i].list(-1)
+	}
+	return snapshot
+}
+
+// Restore replaces all queues with a snapshot. Entries keep their JoinedAt,
+// so restored players keep their place and timeout. It is meant to run at
+// startup, before the queues are in use.
+func (m *Manager) Restore(snapshot map[string][]QueueEntry) {
+	queues := make(map[string]*Queue, len(snapshot))
+	index := make(map[string]*ticket)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+
+	m.queues = queues
+	m.index = index
+	for mode, entries := range snapshot {
+		q := newQueue(m.rulesLocked(mode).Flat)
+		m.queues[mode] = q
+		for _, entry := range entries {
+			if q.push(entry) {
+				m.track(mode, entry)
+			}
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package queue
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// These tests are meant to run with -race. Besides the race detector, they
+// check that the queues and the player index still agree afterwards.
+
+var testModes = []string{"bedwars", "duels", "skywars"}
+
+// TestConcurrentPopTakesEachEntryOnce pops every mode from several
+// goroutines at once. Each entry joined all three modes, so every pop races
+// the others for it, and each player must still be taken exactly once.
+func TestConcurrentPopTakesEachEntryOnce(t *testing.T) {
+	m, _ := NewManager(0)
+	for i := 0; i < 600; i++ {
+		entry := QueueEntry{UUID: fmt.Sprintf("player-%d", i)}
+		if i%3 == 0 {
+			entry.Members = []string{fmt.Sprintf("member-%d", i)}
+		}
+		if _, err := m.JoinModes(testModes, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var mu sync.Mutex
+	taken := make(map[string]int)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 12; g++ {
+		wg.Add(1)
+		go func(mode string) {
+			defer wg.Done()
+			for {
+				entries := pop(m, mode, 1+rand.IntN(4))
+				if entries == nil && m.Size(mode) == 0 {
+					return
+				}
+
+				mu.Lock()
+				for _, entry := range entries {
+					for _, uuid := range entry.Players() {
+						taken[uuid]++
+					}
+				}
+				mu.Unlock()
+			}
+		}(testModes[g%len(testModes)])
+	}
+	wg.Wait()
+
+	if len(taken) != 800 {
+		t.Fatalf("took %d players, want 800", len(taken))
+	}
+	for uuid, n := range taken {
+		if n != 1 {
+			t.Fatalf("%s taken %d times", uuid, n)
+		}
+	}
+	checkConsistent(t, m)
+}
+
+// TestConcurrentJoinLeaveTakePushFront mixes every operation that locks
+// several queues, on players shared between goroutines
+func TestConcurrentJoinLeaveTakePushFront(t *testing.T) {
+	for _, policy := range []JoinPolicy{JoinReject, JoinMove, JoinAdd} {
+		t.Run(string(policy), func(t *testing.T) {
+			m, _ := NewManager(0)
+			m.SetPolicy(policy)
+
+			var wg sync.WaitGroup
+			for g := 0; g < 8; g++ {
+				wg.Add(1)
+				go func(seed uint64) {
+					defer wg.Done()
+					rng := rand.New(rand.NewPCG(seed, seed))
+					for i := 0; i < 500; i++ {
+						churn(m, rng)
+					}
+				}(uint64(g))
+			}
+			wg.Wait()
+
+			checkConsistent(t, m)
+		})
+	}
+}
+
+func TestJoinRejectsInvalidParty(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry QueueEntry
+	}{
+		{"empty leader", QueueEntry{UUID: ""}},
+		{"leader listed as a member", QueueEntry{UUID: "L", Members: []string{"L", "m"}}},
+		{"repeated member", QueueEntry{UUID: "L", Members: []string{"m", "m"}}},
+		{"empty member", QueueEntry{UUID: "L", Members: []string{"m", ""}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := NewManager(0)
+			if _, err := m.Join("skywars", tt.entry); err == nil {
+				t.Fatalf("joined %+v", tt.entry)
+			}
+			if m.Size("skywars") != 0 {
+				t.Fatal("invalid party was queued")
+			}
+		})
+	}
+
+	m, _ := NewManager(0)
+	if _, err := m.Join("skywars", QueueEntry{UUID: "L", Members: []string{"m1", "m2"}}); err != nil {
+		t.Fatal(err)
+	}
+	if m.Size("skywars") != 3 {
+		t.Fatalf("party of 3 counts as %d", m.Size("skywars"))
+	}
+}
+
+// TestTakeSkipsRejoinedEntries checks that an entry the matcher picked is
+// not taken once its leader left and joined again with another party
+func TestTakeSkipsRejoinedEntries(t *testing.T) {
+	m, _ := NewManager(0)
+	m.Join("skywars", QueueEntry{UUID: "L", Members: []string{"m1"}})
+	picked := m.Entries("skywars")
+
+	m.Leave("skywars", "L")
+	m.Join("skywars", QueueEntry{UUID: "L", Members: []string{"m2", "m3"}})
+
+	if m.Take("skywars", picked) {
+		t.Fatal("took the new party with the old party's members")
+	}
+	if m.Size("skywars") != 3 {
+		t.Fatalf("%d players queued, want the new party of 3", m.Size("skywars"))
+	}
+
+	if !m.Take("skywars", m.Entries("skywars")) {
+		t.Fatal("couldn't take the current entry")
+	}
+	checkConsistent(t, m)
+}
+
+// TestOnlyAddingCreatesQueues checks that leaving, moving and taking in a
+// mode nobody joined doesn't create a queue for it
+func TestOnlyAddingCreatesQueues(t *testing.T) {
+	m, _ := NewManager(0)
+	m.Join("skywars", QueueEntry{UUID: "a"})
+
+	if m.Leave("garbage", "a") {
+		t.Error("left a queue that doesn't exist")
+	}
+	if m.MoveToFront("garbage", "a") {
+		t.Error("moved to the front of a queue that doesn't exist")
+	}
+	if m.Take("garbage", []QueueEntry{{UUID: "a"}}) {
+		t.Error("took from a queue that doesn't exist")
+	}
+	if modes := m.Modes(); !slices.Equal(modes, []string{"skywars"}) {
+		t.Fatalf("modes are %v, want [skywars]", modes)
+	}
+
+	m.PushFront("duels", QueueEntry{UUID: "b"})
+	if m.Size("duels") != 1 {
+		t.Fatal("pushing to a new mode didn't create its queue")
+	}
+	checkConsistent(t, m)
+}
+
+// churn runs one random queue operation on a small pool of players
+func churn(m *Manager, rng *rand.Rand) {
+	uuid := fmt.Sprintf("player-%d", rng.IntN(40))
+	mode := testModes[rng.IntN(len(testModes))]
+
+	switch rng.IntN(7) {
+	case 0:
+		m.Join(mode, QueueEntry{UUID: uuid})
+	case 1:
+		modes := slices.Clone(testModes[:1+rng.IntN(len(testModes))])
+		m.JoinModes(modes, QueueEntry{UUID: uuid, Members: []string{uuid + "-friend"}})
+	case 2:
+		m.Leave(mode, uuid)
+	case 3:
+		m.LeaveAll(uuid)
+	case 4:
+		// A match that fails to start puts its players back
+		if entries := pop(m, mode, 2); entries != nil && rng.IntN(2) == 0 {
+			m.PushFront(mode, entries...)
+		}
+	case 5:
+		if entries := m.Peek(mode, 1); entries != nil {
+			m.Take(mode, entries)
+		}
+	case 6:
+		m.MoveToFront(mode, uuid)
+		m.Position(mode, uuid)
+	}
+}
+
+// pop takes entries totalling n players from the front of a queue, the way
+// the matcher does: read the queue, pick, then take
+func pop(m *Manager, mode string, n int) []QueueEntry {
+	for {
+		all := m.Entries(mode)
+
+		var entries []QueueEntry
+		for _, i := range Fill(n)(all) {
+			entries = append(entries, all[i])
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		if m.Take(mode, entries) {
+			return entries
+		}
+	}
+}
+
+// checkConsistent fails if the queues and the player index disagree
+func checkConsistent(t *testing.T, m *Manager) {
+	t.Helper()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+
+	queued := make(map[string]int) // leader → copies across all queues
+	for mode, q := range m.queues {
+		if q.tree.len() != len(q.keys) {
+			t.Fatalf("%s: %d entries in the tree, %d keys", mode, q.tree.len(), len(q.keys))
+		}
+
+		q.tree.each(func(n *node) bool {
+			entry := n.entry
+			tk := m.index[entry.UUID]
+			if tk == nil || tk.leader != entry.UUID || !slices.Contains(tk.modes, mode) {
+				t.Fatalf("%s: %s is queued but not indexed there", mode, entry.UUID)
+			}
+			for _, member := range entry.Members {
+				if m.index[member] != tk {
+					t.Fatalf("%s: member %s of %s is indexed elsewhere", mode, member, entry.UUID)
+				}
+			}
+			if len(tk.modes) > 1 && !sameModes(entry.Modes, tk.modes) {
+				t.Fatalf("%s: %s lists modes %v, index has %v", mode, entry.UUID, entry.Modes, tk.modes)
+			}
+			queued[entry.UUID]++
+			return true
+		})
+	}
+
+	for uuid, tk := range m.index {
+		for _, mode := range tk.modes {
+			if q := m.queues[mode]; q == nil || q.entry(tk.leader) == nil {
+				t.Fatalf("%s is indexed in %s but not queued there", uuid, mode)
+			}
+		}
+		if uuid == tk.leader && queued[uuid] != len(tk.modes) {
+			t.Fatalf("%s is queued %d times for %d modes", uuid, queued[uuid], len(tk.modes))
+		}
+	}
+}
+
+func sameModes(a []string, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+// BenchmarkJoinLeaveParallel joins and leaves from every goroutine. With a
+// mode per goroutine the queue locks never contend; with one shared mode
+// they all do.
+func BenchmarkJoinLeaveParallel(b *testing.B) {
+	for _, shared := range []bool{false, true} {
+		name := "mode-each"
+		if shared {
+			name = "mode-shared"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			m, _ := NewManager(0)
+			var workers atomic.Int64
+
+			b.RunParallel(func(pb *testing.PB) {
+				worker := workers.Add(1)
+				mode := fmt.Sprintf("mode-%d", worker)
+				if shared {
+					mode = "shared"
+				}
+
+				for i := 0; pb.Next(); i++ {
+					uuid := fmt.Sprintf("player-%d-%d", worker, i%100)
+					m.Join(mode, QueueEntry{UUID: uuid})
+					m.Leave(mode, uuid)
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkPositionParallel looks up positions in a large queue while
+// other goroutines look up theirs, as the status endpoint does
+func BenchmarkPositionParallel(b *testing.B) {
+	m, _ := NewManager(0)
+	for i := 0; i < 10000; i++ {
+		m.Join("skywars", QueueEntry{UUID: fmt.Sprintf("player-%d", i)})
+	}
+
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			m.Position("skywars", fmt.Sprintf("player-%d", i%10000))
+		}
+	})
+}
+
+// BenchmarkPopParallel matches from every mode at once while entries that
+// joined several modes are taken from all of them
+func BenchmarkPopParallel(b *testing.B) {
+	m, _ := NewManager(0)
+	var next atomic.Int64
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := next.Add(1)
+			modes := testModes[:1+i%int64(len(testModes))]
+			m.JoinModes(modes, QueueEntry{UUID: fmt.Sprintf("player-%d", i)})
+			pop(m, modes[len(modes)-1], 1)
+		}
+	})
+}
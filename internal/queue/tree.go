@@ -0,0 +1,168 @@
+package queue
+
+import "math/rand/v2"
+
+// tree holds queue entries ordered by key. It is a treap whose
+// nodes also count the entries and players beneath them, so inserts,
+// removals and position lookups all take O(log n).
+type tree struct {
+	root *node
+}
+
+// key orders queue entries by priority tier, then by sequence number
+type key struct {
+	tier int
+	seq  int64
+}
+
+func (k key) less(other key) bool {
+	if k.tier != other.tier {
+		return k.tier < other.tier
+	}
+	return k.seq < other.seq
+}
+
+type node struct {
+	key      key
+	entry    QueueEntry
+	priority uint64
+	left     *node
+	right    *node
+	count    int // entries in this subtree
+	players  int // players in this subtree
+}
+
+func (n *node) update() {
+	n.count = 1
+	n.players = n.entry.Size()
+	if n.left != nil {
+		n.count += n.left.count
+		n.players += n.left.players
+	}
+	if n.right != nil {
+		n.count += n.right.count
+		n.players += n.right.players
+	}
+}
+
+// split divides a subtree into nodes before k and nodes from k on
+func split(n *node, k key) (*node, *node) {
+	if n == nil {
+		return nil, nil
+	}
+	if n.key.less(k) {
+		left, right := split(n.right, k)
+		n.right = left
+		n.update()
+		return n, right
+	}
+	left, right := split(n.left, k)
+	n.left = right
+	n.update()
+	return left, n
+}
+
+// merge joins two subtrees where every node in a comes before b
+func merge(a *node, b *node) *node {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if a.priority > b.priority {
+		a.right = merge(a.right, b)
+		a.update()
+		return a
+	}
+	b.left = merge(a, b.left)
+	b.update()
+	return b
+}
+
+// insert adds an entry at k, which must not be in use
+func (t *tree) insert(k key, entry QueueEntry) {
+	n := &node{key: k, entry: entry, priority: rand.Uint64()}
+	n.update()
+
+	left, right := split(t.root, k)
+	t.root = merge(merge(left, n), right)
+}
+
+// delete removes the entry at k
+func (t *tree) delete(k key) (QueueEntry, bool) {
+	left, rest := split(t.root, k)
+	found, right := split(rest, key{k.tier, k.seq + 1})
+	t.root = merge(left, right)
+
+	if found == nil {
+		return QueueEntry{}, false
+	}
+	return found.entry, true
+}
+
+// get returns the node at k
+func (t *tree) get(k key) *node {
+	n := t.root
+	for n != nil && n.key != k {
+		if k.less(n.key) {
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	return n
+}
+
+// rank returns the number of players in entries up to and including k
+func (t *tree) rank(k key) int {
+	players := 0
+	n := t.root
+	for n != nil {
+		if k.less(n.key) {
+			n = n.left
+			continue
+		}
+		players += n.entry.Size()
+		if n.left != nil {
+			players += n.left.players
+		}
+		if k == n.key {
+			break
+		}
+		n = n.right
+	}
+	return players
+}
+
+// each calls fn for every node in order until fn returns false
+func (t *tree) each(fn func(n *node) bool) {
+	var stack []*node
+	n := t.root
+	for n != nil || len(stack) > 0 {
+		for n != nil {
+			stack = append(stack, n)
+			n = n.left
+		}
+		n = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !fn(n) {
+			return
+		}
+		n = n.right
+	}
+}
+
+func (t *tree) len() int {
+	if t.root == nil {
+		return 0
+	}
+	return t.root.count
+}
+
+func (t *tree) players() int {
+	if t.root == nil {
+		return 0
+	}
+	return t.root.players
+}
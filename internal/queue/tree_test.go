@@ -0,0 +1,235 @@
+package queue
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// sliceQueue is the queue as it was before the tree: a slice in FIFO
+// order, searched from the front. It is the baseline for the benchmarks.
+type sliceQueue struct {
+	entries []QueueEntry
+}
+
+func (q *sliceQueue) push(entry QueueEntry) {
+	q.entries = append(q.entries, entry)
+}
+
+func (q *sliceQueue) remove(uuid string) (QueueEntry, bool) {
+	for i, entry := range q.entries {
+		if entry.Has(uuid) {
+			q.entries = append(q.entries[:i], q.entries[i+1:]...)
+			return entry, true
+		}
+	}
+	return QueueEntry{}, false
+}
+
+func (q *sliceQueue) position(uuid string) (int, bool) {
+	position := 0
+	for _, entry := range q.entries {
+		position += entry.Size()
+		if entry.Has(uuid) {
+			return position, true
+		}
+	}
+	return 0, false
+}
+
+func (q *sliceQueue) pop(sel Selector) []QueueEntry {
+	picked := make(map[int]bool)
+	for _, i := range sel(q.entries) {
+		picked[i] = true
+	}
+
+	var entries []QueueEntry
+	kept := make([]QueueEntry, 0, len(q.entries)-len(picked))
+	for i, entry := range q.entries {
+		if picked[i] {
+			entries = append(entries, entry)
+		} else {
+			kept = append(kept, entry)
+		}
+	}
+	q.entries = kept
+	return entries
+}
+
+// popTree picks entries from a single queue and removes them
+func popTree(q *Queue, sel Selector) []QueueEntry {
+	all := q.list(-1)
+
+	var entries []QueueEntry
+	for _, i := range sel(all) {
+		entries = append(entries, all[i])
+		q.remove(all[i].UUID)
+	}
+	return entries
+}
+
+// benchEntries returns n entries, every fourth a party of two
+func benchEntries(n int) []QueueEntry {
+	entries := make([]QueueEntry, n)
+	for i := range entries {
+		entries[i] = QueueEntry{UUID: fmt.Sprintf("player-%d", i)}
+		if i%4 == 3 {
+			entries[i].Members = []string{fmt.Sprintf("member-%d", i)}
+		}
+	}
+	return entries
+}
+
+var benchSizes = []int{1000, 10000}
+
+func BenchmarkLeave(b *testing.B) {
+	for _, n := range benchSizes {
+		entries := benchEntries(n)
+
+		b.Run(fmt.Sprintf("tree/%d", n), func(b *testing.B) {
+			q := newQueue(false)
+			for _, entry := range entries {
+				q.push(entry)
+			}
+			for i := 0; b.Loop(); i++ {
+				entry, _ := q.remove(entries[i%n].UUID)
+				q.push(entry)
+			}
+		})
+
+		b.Run(fmt.Sprintf("slice/%d", n), func(b *testing.B) {
+			q := &sliceQueue{}
+			for _, entry := range entries {
+				q.push(entry)
+			}
+			for i := 0; b.Loop(); i++ {
+				entry, _ := q.remove(entries[i%n].UUID)
+				q.push(entry)
+			}
+		})
+	}
+}
+
+func BenchmarkPosition(b *testing.B) {
+	for _, n := range benchSizes {
+		entries := benchEntries(n)
+
+		b.Run(fmt.Sprintf("tree/%d", n), func(b *testing.B) {
+			q := newQueue(false)
+			for _, entry := range entries {
+				q.push(entry)
+			}
+			for i := 0; b.Loop(); i++ {
+				q.position(entries[i%n].UUID)
+			}
+		})
+
+		b.Run(fmt.Sprintf("slice/%d", n), func(b *testing.B) {
+			q := &sliceQueue{}
+			for _, entry := range entries {
+				q.push(entry)
+			}
+			for i := 0; b.Loop(); i++ {
+				q.position(entries[i%n].UUID)
+			}
+		})
+	}
+}
+
+// BenchmarkPop takes a match of four from the front and puts the players
+// back at the end, so the queue keeps its size
+func BenchmarkPop(b *testing.B) {
+	for _, n := range benchSizes {
+		entries := benchEntries(n)
+
+		b.Run(fmt.Sprintf("tree/%d", n), func(b *testing.B) {
+			q := newQueue(false)
+			for _, entry := range entries {
+				q.push(entry)
+			}
+			for b.Loop() {
+				for _, entry := range popTree(q, Fill(4)) {
+					q.push(entry)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("slice/%d", n), func(b *testing.B) {
+			q := &sliceQueue{}
+			for _, entry := range entries {
+				q.push(entry)
+			}
+			for b.Loop() {
+				for _, entry := range q.pop(Fill(4)) {
+					q.push(entry)
+				}
+			}
+		})
+	}
+}
+
+// TestTreeMatchesSlice runs the same random joins, leaves, pops and
+// position lookups against the tree and the slice it replaced
+func TestTreeMatchesSlice(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	entries := benchEntries(500)
+
+	tq := newQueue(false)
+	sq := &sliceQueue{}
+	queued := make(map[string]bool)
+
+	for step := 0; step < 20000; step++ {
+		entry := entries[rng.IntN(len(entries))]
+		switch rng.IntN(4) {
+		case 0:
+			if !queued[entry.UUID] {
+				tq.push(entry)
+				sq.push(entry)
+				queued[entry.UUID] = true
+			}
+		case 1:
+			_, inTree := tq.remove(entry.UUID)
+			_, inSlice := sq.remove(entry.UUID)
+			if inTree != inSlice {
+				t.Fatalf("step %d: removing %s gave %v from the tree, %v from the slice", step, entry.UUID, inTree, inSlice)
+			}
+			delete(queued, entry.UUID)
+		case 2:
+			n := 1 + rng.IntN(6)
+			fromTree := popTree(tq, Fill(n))
+			fromSlice := sq.pop(Fill(n))
+			if !slices.EqualFunc(fromTree, fromSlice, sameEntry) {
+				t.Fatalf("step %d: popping %d gave %v from the tree, %v from the slice", step, n, fromTree, fromSlice)
+			}
+			for _, popped := range fromTree {
+				delete(queued, popped.UUID)
+			}
+		case 3:
+			treePos, inTree := tq.position(entry.UUID)
+			slicePos, inSlice := sq.position(entry.UUID)
+			if treePos != slicePos || inTree != inSlice {
+				t.Fatalf("step %d: %s at %d (%v) in the tree, %d (%v) in the slice", step, entry.UUID, treePos, inTree, slicePos, inSlice)
+			}
+		}
+	}
+
+	if !slices.EqualFunc(tq.list(-1), sq.entries, sameEntry) {
+		t.Fatal("tree and slice ended in a different order")
+	}
+	if tq.tree.players() != playerCount(sq.entries) {
+		t.Fatalf("tree counts %d players, slice %d", tq.tree.players(), playerCount(sq.entries))
+	}
+}
+
+func sameEntry(a QueueEntry, b QueueEntry) bool {
+	return a.UUID == b.UUID
+}
+
+func playerCount(entries []QueueEntry) int {
+	players := 0
+	for _, entry := range entries {
+		players += entry.Size()
+	}
+	return players
+}
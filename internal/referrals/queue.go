@@ -36,3 +36,24 @@ func (q *Queue) GetAndClear(serverID string) []Referral {
 	delete(q.pending, serverID)
 	return refs
 }
+
+func (q *Queue) Pending() map[string][]Referral {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pending := make(map[string][]Referral, len(q.pending))
+	for serverID, refs := range q.pending {
+		pending[serverID] = append([]Referral(nil), refs...)
+	}
+	return pending
+}
+
+func (q *Queue) Restore(pending map[string][]Referral) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.pending = make(map[string][]Referral, len(pending))
+	for serverID, refs := range pending {
+		q.pending[serverID] = append([]Referral(nil), refs...)
+	}
+}
@@ -0,0 +1,211 @@
+package registryview
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bananalabs-oss/potassium/registry"
+)
+
+// View keeps a local snapshot of every server and match in the Bananagine
+// registry. It is refreshed on one shared interval, or immediately when
+// Invalidate is called, so callers read from memory instead of querying
+// the registry themselves.
+type View struct {
+	url      string
+	interval time.Duration
+	client   *http.Client
+
+	mu        sync.RWMutex
+	servers   map[string]registry.ServerInfo // key = server ID
+	overrides map[string]override            // "server/match" → local change
+
+	invalidate chan struct{}
+	updates    chan struct{}
+}
+
+// override is a match change made locally that a refresh already in flight
+// may not include yet
+type override struct {
+	serverID string
+	matchID  string
+	match    registry.MatchInfo
+	at       time.Time
+}
+
+// New creates a new registry view
+func New(registryURL string, interval time.Duration) *View {
+	return &View{
+		url:        registryURL,
+		interval:   interval,
+		client:     &http.Client{Timeout: 5 * time.Second},
+		servers:    make(map[string]registry.ServerInfo),
+		overrides:  make(map[string]override),
+		invalidate: make(chan struct{}, 1),
+		updates:    make(chan struct{}, 1),
+	}
+}
+
+// Start loads the first snapshot and begins the refresh loop
+func (v *View) Start() {
+	if err := v.Refresh(); err != nil {
+		fmt.Printf("[Registry] %v\n", err)
+	}
+
+	ticker := time.NewTicker(v.interval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+			case <-v.invalidate:
+			}
+
+			if err := v.Refresh(); err != nil {
+				fmt.Printf("[Registry] %v\n", err)
+			}
+		}
+	}()
+}
+
+// Invalidate schedules an immediate refresh. Safe to call from a change
+// notification handler; repeated calls before the refresh runs collapse
+// into one.
+func (v *View) Invalidate() {
+	select {
+	case v.invalidate <- struct{}{}:
+	default:
+	}
+}
+
+// Updates signals after every successful refresh
+func (v *View) Updates() <-chan struct{} {
+	return v.updates
+}
+
+// Refresh replaces the snapshot with the registry's current server list
+func (v *View) Refresh() error {
+	started := time.Now()
+
+	resp, err := v.client.Get(v.url + "/registry/servers")
+	if err != nil {
+		return fmt.Errorf("refresh failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("refresh failed: registry returned %d", resp.StatusCode)
+	}
+
+	var list []registry.ServerInfo
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return fmt.Errorf("refresh failed: %w", err)
+	}
+
+	servers := make(map[string]registry.ServerInfo, len(list))
+	for _, server := range list {
+		servers[server.ID] = server
+	}
+
+	v.mu.Lock()
+	v.servers = servers
+
+	// Local changes made after the request started may be missing from it
+	for key, o := range v.overrides {
+		if o.at.Before(started) {
+			delete(v.overrides, key)
+			continue
+		}
+		v.applyMatch(o.serverID, o.matchID, o.match)
+	}
+	v.mu.Unlock()
+
+	select {
+	case v.updates <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Get returns a server by ID
+func (v *View) Get(id string) (registry.ServerInfo, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	server, ok := v.servers[id]
+	return server, ok
+}
+
+// List returns servers matching the filter, ordered by ID. It applies the
+// same rules as the registry's own list query.
+func (v *View) List(filter registry.ListFilter) []registry.ServerInfo {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	var result []registry.ServerInfo
+	for _, server := range v.servers {
+		if filter.Type != "" && server.Type != filter.Type {
+			continue
+		}
+		if filter.Mode != "" && server.Mode != filter.Mode {
+			continue
+		}
+		if filter.HasCapacity && server.Players >= server.MaxPlayers {
+			continue
+		}
+		if filter.HasReadyMatch && !hasReadyMatch(server) {
+			continue
+		}
+		result = append(result, server)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// SetMatch records a match change made by Bananasplit, so the snapshot
+// reflects it before the next refresh
+func (v *View) SetMatch(serverID string, matchID string, match registry.MatchInfo) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.overrides[serverID+"/"+matchID] = override{
+		serverID: serverID,
+		matchID:  matchID,
+		match:    match,
+		at:       time.Now(),
+	}
+	v.applyMatch(serverID, matchID, match)
+}
+
+// applyMatch writes a match into the snapshot. Callers must hold mu.
+func (v *View) applyMatch(serverID string, matchID string, match registry.MatchInfo) {
+	server, ok := v.servers[serverID]
+	if !ok {
+		return
+	}
+
+	// Copy on write: callers may still hold the old map
+	matches := make(map[string]registry.MatchInfo, len(server.Matches)+1)
+	for id, info := range server.Matches {
+		matches[id] = info
+	}
+	matches[matchID] = match
+
+	server.Matches = matches
+	v.servers[serverID] = server
+}
+
+func hasReadyMatch(server registry.ServerInfo) bool {
+	for _, match := range server.Matches {
+		if match.Status == registry.StatusReady {
+			return true
+		}
+	}
+	return false
+}
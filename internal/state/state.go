@@ -0,0 +1,107 @@
+package state
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bananalabs-oss/bananasplit/internal/matches"
+	"github.com/bananalabs-oss/bananasplit/internal/penalties"
+	"github.com/bananalabs-oss/bananasplit/internal/players"
+	"github.com/bananalabs-oss/bananasplit/internal/queue"
+	"github.com/bananalabs-oss/bananasplit/internal/referrals"
+)
+
+// Snapshot is the persisted state of a Bananasplit instance
+type Snapshot struct {
+	SavedAt   time.Time                       `json:"savedAt"`
+	Queues    map[string][]queue.QueueEntry   `json:"queues"`
+	Players   []players.Player                `json:"players"`
+	Referrals map[string][]referrals.Referral `json:"referrals"`
+	Matches   []matches.Match                 `json:"matches"`
+	Penalties []penalties.Penalty             `json:"penalties"`
+	Paused    []string                        `json:"paused,omitempty"` // modes with matching paused
+}
+
+// Backend stores and loads snapshots
+type Backend interface {
+	// Load returns the last saved snapshot, or nil if nothing was saved yet
+	Load() (*Snapshot, error)
+	Save(snapshot *Snapshot) error
+}
+
+// Store periodically snapshots queues, player locations, pending referrals,
+// tracked matches and penalties to a backend so they survive restarts
+type Store struct {
+	backend   Backend
+	queues    *queue.Manager
+	players   *players.Registry
+	referrals *referrals.Queue
+	matches   *matches.Store
+	penalties *penalties.Tracker
+}
+
+// New creates a new state store
+func New(backend Backend, queues *queue.Manager, playerRegistry *players.Registry, referralQueue *referrals.Queue, matchStore *matches.Store, penaltyTracker *penalties.Tracker) *Store {
+	return &Store{
+		backend:   backend,
+		queues:    queues,
+		players:   playerRegistry,
+		referrals: referralQueue,
+		matches:   matchStore,
+		penalties: penaltyTracker,
+	}
+}
+
+// Restore loads the last snapshot into the queues, registry, referrals,
+// match store and penalty tracker
+func (s *Store) Restore() error {
+	snapshot, err := s.backend.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+	if snapshot == nil {
+		return nil
+	}
+
+	s.queues.Restore(snapshot.Queues)
+	s.players.Restore(snapshot.Players)
+	s.referrals.Restore(snapshot.Referrals)
+	s.matches.Restore(snapshot.Matches)
+	s.penalties.Restore(snapshot.Penalties)
+	for _, mode := range snapshot.Paused {
+		s.queues.Pause(mode)
+	}
+
+	fmt.Printf("[State] Restored snapshot from %s\n", snapshot.SavedAt.Format(time.RFC3339))
+	return nil
+}
+
+// Save writes the current state to the backend
+func (s *Store) Save() error {
+	snapshot := &Snapshot{
+		SavedAt:   time.Now(),
+		Queues:    s.queues.Snapshot(),
+		Players:   s.players.List(),
+		Referrals: s.referrals.Pending(),
+		Matches:   s.matches.List("", ""),
+		Penalties: s.penalties.List(),
+		Paused:    s.queues.Paused(),
+	}
+
+	if err := s.backend.Save(snapshot); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+	return nil
+}
+
+// Start begins saving a snapshot every interval
+func (s *Store) Start(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			if err := s.Save(); err != nil {
+				fmt.Printf("[State] %v\n", err)
+			}
+		}
+	}()
+}